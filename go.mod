@@ -6,4 +6,5 @@ require (
 	github.com/hashicorp/hcl/v2 v2.9.1
 	github.com/hashicorp/packer-plugin-sdk v0.2.0
 	github.com/zclconf/go-cty v1.8.1
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 )
@@ -0,0 +1,119 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const (
+	aptConfDir             = "/etc/apt/apt.conf.d"
+	defaultReleaseConfFile = "00packer-default-release"
+)
+
+// uploadAptConf writes an apt.conf(5) snippet to the guest and remembers it
+// so that it can be removed once provisioning is done.
+func (p *Provisioner) uploadAptConf(comm packer.Communicator, name string, content string) error {
+	dst := path.Join(aptConfDir, name)
+	if err := comm.Upload(dst, strings.NewReader(content), nil); err != nil {
+		return err
+	}
+	p.aptConfFiles = append(p.aptConfFiles, dst)
+	return nil
+}
+
+func (p *Provisioner) uploadDefaultRelease(comm packer.Communicator) error {
+	return p.uploadAptConf(comm, defaultReleaseConfFile,
+		fmt.Sprintf("APT::Default-Release \"%s\";\n", p.config.DefaultRelease))
+}
+
+// renderDownloadLimits renders the options that cap the requests apt makes
+// to each mirror. In host queue mode apt runs one download process, with a
+// single connection, per host, and the pipeline depth bounds the requests in
+// flight on it.
+func renderDownloadLimits(perHost int) string {
+	return fmt.Sprintf(`Acquire::Queue-Mode "host";
+Acquire::http::Pipeline-Depth "%[1]d";
+Acquire::https::Pipeline-Depth "%[1]d";
+`, perHost)
+}
+
+func (p *Provisioner) uploadDownloadLimits(comm packer.Communicator) error {
+	return p.uploadAptConf(comm, "00packer-download-limits", renderDownloadLimits(p.config.MaxDownloadsPerHost))
+}
+
+// renderProxy renders the proxies apt uses for http and https downloads.
+func renderProxy(httpProxy, httpsProxy string) string {
+	var conf string
+	if httpProxy != "" {
+		conf += fmt.Sprintf("Acquire::http::Proxy \"%s\";\n", httpProxy)
+	}
+	if httpsProxy != "" {
+		conf += fmt.Sprintf("Acquire::https::Proxy \"%s\";\n", httpsProxy)
+	}
+	return conf
+}
+
+func (p *Provisioner) uploadProxy(comm packer.Communicator) error {
+	return p.uploadAptConf(comm, "00packer-proxy", renderProxy(p.config.Proxy, p.config.HTTPSProxy))
+}
+
+// cleanupFiles returns the guest files created by the provisioner that should
+// not remain in the image.
+func (p *Provisioner) cleanupFiles() []string {
+	var files []string
+	for _, file := range p.aptConfFiles {
+		if p.config.KeepDefaultRelease && file == path.Join(aptConfDir, defaultReleaseConfFile) {
+			continue
+		}
+		files = append(files, file)
+	}
+	if p.ephemeralStateDir != "" {
+		files = append(files, p.ephemeralStateDir)
+	}
+	if !p.config.CleanupSources.False() {
+		if len(p.config.Sources) != 0 {
+			files = append(files, path.Join(p.config.SourcesListDir, p.config.SourcesFilename))
+		}
+		if len(p.config.Deb822Sources) != 0 {
+			files = append(files, path.Join(p.config.SourcesListDir, p.config.deb822FileName()))
+		}
+	}
+	if p.config.CleanupPreferences && p.preferencesUploaded {
+		files = append(files, preferencesFile)
+	}
+	if p.config.CleanupKeys {
+		files = append(files, p.keyFiles...)
+	}
+	return files
+}
+
+// defaultSlimImagePaths are removed by slim_image unless slim_image_paths
+// overrides them. They are shell globs, so the directories themselves stay.
+var defaultSlimImagePaths = []string{
+	"/var/lib/apt/lists/*",
+	"/var/log/apt/*",
+	"/var/cache/apt/archives/*",
+}
+
+func (p *Provisioner) slimRemoteImage(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say("Removing APT lists, logs and archives from the image")
+	return runRemoteCommand(ctx, ui, comm, "/bin/rm -rf "+strings.Join(p.config.SlimImagePaths, " "))
+}
+
+func removeRemoteFiles(ctx context.Context, ui packer.Ui, comm packer.Communicator, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	cmd := &packer.RemoteCmd{Command: "/bin/rm -rf '" + strings.Join(files, "' '") + "'"}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("rm exited with status %d", status)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package apt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestSlimRemoteImage(t *testing.T) {
+	for _, status := range []int{0, 1} {
+		comm := &fakeComm{status: func(string) int { return status }}
+		p := &Provisioner{config: Config{SlimImagePaths: defaultSlimImagePaths}}
+
+		err := p.slimRemoteImage(context.Background(), packer.TestUi(t), comm)
+		if (err != nil) != (status != 0) {
+			t.Errorf("exit status %d: got error %v", status, err)
+		}
+		want := "/bin/rm -rf /var/lib/apt/lists/* /var/log/apt/* /var/cache/apt/archives/*"
+		if len(comm.commands) != 1 || comm.commands[0] != want {
+			t.Errorf("commands %q, want %q", comm.commands, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package apt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// aptfileRepoPrefix marks an Aptfile line that adds an APT source instead of
+// packages.
+const aptfileRepoPrefix = ":repo:"
+
+// parseAptfile reads an Aptfile in the format of the Heroku apt buildpack:
+// whitespace separated packages, # comments and :repo: lines that add a
+// sources.list entry. Direct .deb URLs are not supported.
+func parseAptfile(r io.Reader) (packages []string, sources []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, aptfileRepoPrefix) {
+			source := strings.TrimSpace(strings.TrimPrefix(line, aptfileRepoPrefix))
+			if !strings.HasPrefix(source, "deb ") && !strings.HasPrefix(source, "deb-src ") {
+				return nil, nil, fmt.Errorf("line %d: invalid repository %q", n, scanner.Text())
+			}
+			sources = append(sources, source)
+			continue
+		}
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		for _, pkg := range strings.Fields(line) {
+			if strings.Contains(pkg, "://") {
+				return nil, nil, fmt.Errorf("line %d: .deb URLs are not supported, use deb_files: %q", n, pkg)
+			}
+			if !packageSpecRe.MatchString(pkg) {
+				return nil, nil, fmt.Errorf("line %d: invalid package %q", n, pkg)
+			}
+			packages = append(packages, pkg)
+		}
+	}
+	return packages, sources, scanner.Err()
+}
+
+func readAptfile(name string) ([]string, []string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	packages, sources, err := parseAptfile(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return packages, sources, nil
+}
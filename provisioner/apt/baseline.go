@@ -0,0 +1,47 @@
+package apt
+
+import (
+	"path"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// defaultSecurityBaselinePackages are installed by security_baseline unless
+// security_baseline_packages overrides them.
+var defaultSecurityBaselinePackages = []string{
+	// Installs security updates unattended, configured below.
+	"unattended-upgrades",
+	// Shows the changelogs and news of upgraded packages.
+	"apt-listchanges",
+	// Restarts services still running outdated libraries after upgrades.
+	"needrestart",
+	// Verifies installed files against the package checksums.
+	"debsums",
+}
+
+const unattendedUpgradesConfFile = "52packer-unattended-upgrades"
+
+// unattendedUpgradesConf limits unattended-upgrades to the security archive
+// of the running distribution and enables the daily run.
+const unattendedUpgradesConf = `#clear Unattended-Upgrade::Origins-Pattern;
+#clear Unattended-Upgrade::Allowed-Origins;
+Unattended-Upgrade::Origins-Pattern {
+	"origin=${distro_id},codename=${distro_codename},label=${distro_id}-Security";
+	"origin=${distro_id},codename=${distro_codename}-security,label=${distro_id}-Security";
+};
+APT::Periodic::Update-Package-Lists "1";
+APT::Periodic::Unattended-Upgrade "1";
+`
+
+// uploadSecurityBaseline configures unattended-upgrades when the baseline
+// installs it. Unlike the other apt.conf snippets, the file stays in the
+// image.
+func (p *Provisioner) uploadSecurityBaseline(ui packer.Ui, comm packer.Communicator) error {
+	if !containsString(p.config.SecurityBaselinePackages, "unattended-upgrades") {
+		return nil
+	}
+	ui.Say("Configuring unattended-upgrades for security updates only")
+	dst := path.Join(aptConfDir, unattendedUpgradesConfFile)
+	return comm.Upload(dst, strings.NewReader(unattendedUpgradesConf), nil)
+}
@@ -0,0 +1,77 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// maxCacheArchExamples bounds the mismatching packages named in the warning.
+const maxCacheArchExamples = 3
+
+// debArch returns the architecture of a name_version_arch.deb file name.
+func debArch(name string) (string, bool) {
+	if !strings.HasSuffix(name, ".deb") {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(name, ".deb"), "_")
+	if len(parts) != 3 || parts[2] == "" {
+		return "", false
+	}
+	return parts[2], true
+}
+
+// foreignDebs returns the .deb file names built for none of the given
+// architectures. Architecture independent packages match every guest.
+func foreignDebs(names []string, arches []string) []string {
+	var foreign []string
+	for _, name := range names {
+		arch, ok := debArch(name)
+		if !ok || arch == "all" || containsString(arches, arch) {
+			continue
+		}
+		foreign = append(foreign, name)
+	}
+	sort.Strings(foreign)
+	return foreign
+}
+
+// validateCacheArch checks that the packages in the host cache are built for
+// the native or a foreign architecture of the guest.
+func (p *Provisioner) validateCacheArch(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	facts, err := p.guestFacts(ctx, comm)
+	if err != nil {
+		return err
+	}
+	output, err := runRemoteOutput(ctx, comm, "/usr/bin/dpkg --print-foreign-architectures")
+	if err != nil {
+		return err
+	}
+	arches := append([]string{facts.Arch}, strings.Fields(output)...)
+
+	entries, err := ioutil.ReadDir(p.cacheDir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	foreign := foreignDebs(names, arches)
+	if len(foreign) == 0 {
+		return nil
+	}
+	examples := foreign
+	if len(examples) > maxCacheArchExamples {
+		examples = examples[:maxCacheArchExamples]
+	}
+	return p.softFail(ui, fmt.Sprintf("Host APT cache %s has %d packages not built for %s: %s",
+		p.cacheDir, len(foreign), strings.Join(arches, ", "), strings.Join(examples, " ")))
+}
@@ -0,0 +1,47 @@
+package apt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// aptOptions returns the key=value pairs set with -o in args, in either the
+// "-o", "key=value" or the "-okey=value" form.
+func aptOptions(args []string) []string {
+	var options []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case (arg == "-o" || arg == "--option") && i+1 < len(args):
+			i++
+			options = append(options, args[i])
+		case strings.HasPrefix(arg, "-o") && len(arg) > 2:
+			options = append(options, arg[2:])
+		case strings.HasPrefix(arg, "--option="):
+			options = append(options, strings.TrimPrefix(arg, "--option="))
+		}
+	}
+	return options
+}
+
+// validateCacheOrder rejects extra arguments that leave nothing in the
+// archive cache for the write-back to cache_dir, which runs after the
+// install but before apt-get clean.
+func (c *Config) validateCacheOrder() error {
+	for _, option := range aptOptions(c.ExtraArguments) {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(parts[0])
+		switch {
+		case key == "apt::keep-downloaded-packages" || key == "binary::apt::apt::keep-downloaded-packages":
+			switch strings.ToLower(parts[1]) {
+			case "false", "0", "no", "off":
+				return fmt.Errorf("extra_arguments: %s deletes downloaded packages before cache_dir is updated", option)
+			}
+		case key == "dir" || strings.HasPrefix(key, "dir::cache"):
+			return fmt.Errorf("extra_arguments: %s moves downloaded packages out of the archive cache that cache_dir is updated from", option)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// lockedUi serializes the output of concurrent workers, so that their lines
+// are interleaved but never mixed.
+type lockedUi struct {
+	packer.Ui
+	mu sync.Mutex
+}
+
+func (u *lockedUi) Say(line string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.Ui.Say(line)
+}
+
+func (u *lockedUi) Message(line string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.Ui.Message(line)
+}
+
+func (u *lockedUi) Error(line string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.Ui.Error(line)
+}
+
+// runConcurrently calls fn for each item with at most limit calls running at
+// once. The first error cancels the context of the remaining calls, and the
+// errors of all calls that failed for another reason than the cancellation
+// are returned together.
+func runConcurrently(ctx context.Context, limit int, items []string, fn func(context.Context, string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs *packer.MultiError
+	)
+	sem := make(chan struct{}, limit)
+	for _, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(item string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, item); err != nil {
+				mu.Lock()
+				if errs == nil || !errors.Is(err, context.Canceled) {
+					errs = packer.MultiErrorAppend(errs, err)
+				}
+				mu.Unlock()
+				cancel()
+			}
+		}(item)
+	}
+	wg.Wait()
+
+	if errs == nil {
+		return ctx.Err()
+	}
+	if len(errs.Errors) == 1 {
+		return errs.Errors[0]
+	}
+	return errs
+}
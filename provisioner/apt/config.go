@@ -1,20 +1,214 @@
-//go:generate mapstructure-to-hcl2 -type Config
+//go:generate mapstructure-to-hcl2 -type Config,OriginPin,Preference,RawPackageIndex,QuickSource,Deb822Source,GitHubReleaseDeb
 //go:generate packer-sdc struct-markdown
 package apt
 
 import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 )
 
+var (
+	unitNameRe    = regexp.MustCompile(`^[A-Za-z0-9:_.\\@-]+$`)
+	packageNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+	localeRe      = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+	envVarRe      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	versionRe     = regexp.MustCompile(`^([0-9]+:)?[0-9][A-Za-z0-9.+~:-]*$`)
+	versionGlobRe = regexp.MustCompile(`^[A-Za-z0-9.+~:*?-]+$`)
+	hostnameRe    = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+	kernelRe      = regexp.MustCompile(`^[0-9][A-Za-z0-9.+_~-]*$`)
+	devicePathRe  = regexp.MustCompile(`^/dev/[A-Za-z0-9/_.:-]+$`)
+	argumentRe    = regexp.MustCompile(`^[A-Za-z0-9_.,:=+/@%~-]+$`)
+)
+
 type Config struct {
-	common.PackerConfig `mapstructure:",squash"`
-	Packages            []string `mapstructure:"packages"`
-	Sources             []string `mapstructure:"sources"`
-	Keys                []string `mapstructure:"keys"`
-	CacheDir            string   `mapstructure:"cache_dir"`
-	ctx                 interpolate.Context
+	common.PackerConfig      `mapstructure:",squash"`
+	Packages                 []string            `mapstructure:"packages"`
+	Sources                  []string            `mapstructure:"sources"`
+	Keys                     []string            `mapstructure:"keys"`
+	CacheDir                 string              `mapstructure:"cache_dir"`
+	ProgressFd               bool                `mapstructure:"progress_fd"`
+	EnableServices           []string            `mapstructure:"enable_services"`
+	DisableServices          []string            `mapstructure:"disable_services"`
+	MaskServices             []string            `mapstructure:"mask_services"`
+	Strict                   bool                `mapstructure:"strict"`
+	OriginPins               []OriginPin         `mapstructure:"origin_pins"`
+	AssertConsistent         bool                `mapstructure:"assert_consistent"`
+	SourcesListDir           string              `mapstructure:"sources_list_dir"`
+	SourcesFilename          string              `mapstructure:"sources_filename"`
+	KeyFileMode              string              `mapstructure:"key_file_mode"`
+	ExcludeDependencies      map[string][]string `mapstructure:"exclude_dependencies"`
+	KeyDownloadTimeout       time.Duration       `mapstructure:"key_download_timeout"`
+	KeyDownloadRetries       int                 `mapstructure:"key_download_retries"`
+	PackagesFile             string              `mapstructure:"packages_file"`
+	Aptfile                  string              `mapstructure:"aptfile"`
+	Remove                   []string            `mapstructure:"remove"`
+	Purge                    []string            `mapstructure:"purge"`
+	Hold                     []string            `mapstructure:"hold"`
+	ProcessTriggers          bool                `mapstructure:"process_triggers"`
+	ListsCacheDir            string              `mapstructure:"lists_cache_dir"`
+	CommandPrefix            string              `mapstructure:"command_prefix"`
+	RemoveOrphans            bool                `mapstructure:"remove_orphans"`
+	MigrateLegacyKeys        bool                `mapstructure:"migrate_legacy_keys"`
+	MinAptVersion            string              `mapstructure:"min_apt_version"`
+	PackageGroups            map[string][]string `mapstructure:"package_groups"`
+	InstallGroupsSelected    []string            `mapstructure:"install_groups_selected"`
+	DefaultRelease           string              `mapstructure:"default_release"`
+	KeepDefaultRelease       bool                `mapstructure:"keep_default_release"`
+	VerifyCleanup            bool                `mapstructure:"verify_cleanup"`
+	ReportGroups             bool                `mapstructure:"report_groups"`
+	DebFiles                 []string            `mapstructure:"deb_files"`
+	UseGdebi                 bool                `mapstructure:"use_gdebi"`
+	NamespaceCache           bool                `mapstructure:"namespace_cache"`
+	RequireNetwork           bool                `mapstructure:"require_network"`
+	MirrorCheckTimeout       time.Duration       `mapstructure:"mirror_check_timeout"`
+	MirrorCheckRetries       int                 `mapstructure:"mirror_check_retries"`
+	AutoResolveUnmet         bool                `mapstructure:"auto_resolve_unmet"`
+	UnmetPolicy              string              `mapstructure:"unmet_policy"`
+	ReproducibleCacheExport  string              `mapstructure:"reproducible_cache_export"`
+	AutoFetchMissingKeys     bool                `mapstructure:"auto_fetch_missing_keys"`
+	DefaultKeyserver         string              `mapstructure:"default_keyserver"`
+	Keyservers               []string            `mapstructure:"keyservers"`
+	KeyserverRetries         int                 `mapstructure:"keyserver_retries"`
+	KeyserverTimeout         time.Duration       `mapstructure:"keyserver_timeout"`
+	Upgrade                  string              `mapstructure:"upgrade"`
+	ReportKeptBack           bool                `mapstructure:"report_kept_back"`
+	PerPackageTimeout        time.Duration       `mapstructure:"per_package_timeout"`
+	SkipOnTimeout            bool                `mapstructure:"skip_on_timeout"`
+	AptLocale                string              `mapstructure:"apt_locale"`
+	SanitizeGuestCache       config.Trilean      `mapstructure:"sanitize_guest_cache"`
+	LockfileOut              string              `mapstructure:"lockfile_out"`
+	LockfileIn               string              `mapstructure:"lockfile_in"`
+	KeyFingerprints          map[string]string   `mapstructure:"key_fingerprints"`
+	SecurityBaseline         bool                `mapstructure:"security_baseline"`
+	SecurityBaselinePackages []string            `mapstructure:"security_baseline_packages"`
+	VerifyDebsums            bool                `mapstructure:"verify_debsums"`
+	UpgradeOrder             string              `mapstructure:"upgrade_order"`
+	RawPackageIndexes        []RawPackageIndex   `mapstructure:"raw_package_indexes"`
+	Explain                  bool                `mapstructure:"explain"`
+	DualKeyInstall           bool                `mapstructure:"dual_key_install"`
+	MaxDownloadsPerHost      int                 `mapstructure:"max_downloads_per_host"`
+	SaveUpdateOutput         string              `mapstructure:"save_update_output"`
+	EnsureQemuUserStatic     bool                `mapstructure:"ensure_qemu_user_static"`
+	InstallQemuUserStatic    bool                `mapstructure:"install_qemu_user_static"`
+	FailPhases               []string            `mapstructure:"fail_phases" undocumented:"true"`
+	DumpResolvedConfig       string              `mapstructure:"dump_resolved_config"`
+	PartialInstallPolicy     string              `mapstructure:"partial_install_policy"`
+	GitHubReleaseDebs        []GitHubReleaseDeb  `mapstructure:"github_release_debs"`
+	GitHubToken              string              `mapstructure:"github_token"`
+	SlimImage                bool                `mapstructure:"slim_image"`
+	SlimImagePaths           []string            `mapstructure:"slim_image_paths"`
+	SourceProbes             map[string]string   `mapstructure:"source_probes"`
+	DNSProbeHost             []string            `mapstructure:"dns_probe_host"`
+	WaitForDNS               config.Trilean      `mapstructure:"wait_for_dns"`
+	DNSTestCommand           string              `mapstructure:"dns_test_command"`
+	Solver                   string              `mapstructure:"solver"`
+	RebootIfRequired         bool                `mapstructure:"reboot_if_required"`
+	RebootTimeout            time.Duration       `mapstructure:"reboot_timeout"`
+	IncludeSourceRepos       bool                `mapstructure:"include_source_repos"`
+	UseSudo                  bool                `mapstructure:"use_sudo"`
+	SudoCommand              string              `mapstructure:"sudo_command"`
+	FixBroken                bool                `mapstructure:"fix_broken"`
+	FixBrokenAttempts        int                 `mapstructure:"fix_broken_attempts"`
+	SkipNewerInstalled       bool                `mapstructure:"skip_newer_installed"`
+	ExtraArguments           []string            `mapstructure:"extra_arguments"`
+	QuickSource              QuickSource         `mapstructure:"quick_source"`
+	InstallRecommends        bool                `mapstructure:"install_recommends"`
+	FailOnKeptBack           bool                `mapstructure:"fail_on_kept_back"`
+	VersionRanges            map[string]string   `mapstructure:"version_ranges"`
+	PrintURIs                string              `mapstructure:"print_uris"`
+	Autoremove               bool                `mapstructure:"autoremove"`
+	GrubInstallDevices       []string            `mapstructure:"grub_install_devices"`
+	Umask                    string              `mapstructure:"umask"`
+	Deb822Sources            []Deb822Source      `mapstructure:"deb822_sources"`
+	RetryTries               int                 `mapstructure:"retry_tries"`
+	RetryDelay               time.Duration       `mapstructure:"retry_delay"`
+	DKMSKernelVersion        string              `mapstructure:"dkms_kernel_version"`
+	ForceYes                 bool                `mapstructure:"force_yes"`
+	Proxy                    string              `mapstructure:"proxy"`
+	HTTPSProxy               string              `mapstructure:"https_proxy"`
+	CaptureDpkgLog           string              `mapstructure:"capture_dpkg_log"`
+	Frontend                 string              `mapstructure:"frontend"`
+	Preseed                  []string            `mapstructure:"preseed"`
+	PreseedFile              string              `mapstructure:"preseed_file"`
+	EphemeralAptState        bool                `mapstructure:"ephemeral_apt_state"`
+	UploadCache              config.Trilean      `mapstructure:"upload_cache"`
+	WritebackCache           config.Trilean      `mapstructure:"writeback_cache"`
+	ValidateCacheArch        bool                `mapstructure:"validate_cache_arch"`
+	CleanupSources           config.Trilean      `mapstructure:"cleanup_sources"`
+	CleanupKeys              bool                `mapstructure:"cleanup_keys"`
+	GuardCacheOrder          bool                `mapstructure:"guard_cache_order"`
+	Architectures            []string            `mapstructure:"architectures"`
+	Preferences              []Preference        `mapstructure:"preferences"`
+	CleanupPreferences       bool                `mapstructure:"cleanup_preferences"`
+	MaxRemovals              int                 `mapstructure:"max_removals"`
+	AllowEssentialRemoval    bool                `mapstructure:"allow_essential_removal"`
+	LicenseReport            string              `mapstructure:"license_report"`
+	UploadConcurrency        int                 `mapstructure:"upload_concurrency"`
+	AllowReleaseinfoChange   bool                `mapstructure:"allow_releaseinfo_change"`
+	AutoHandleKeyRotation    bool                `mapstructure:"auto_handle_key_rotation"`
+	EnvironmentVars          []string            `mapstructure:"environment_vars"`
+	DryRun                   bool                `mapstructure:"dry_run"`
+	PackageDiffReport        string              `mapstructure:"package_diff_report"`
+	PreCommands              []string            `mapstructure:"pre_commands"`
+	PostCommands             []string            `mapstructure:"post_commands"`
+	CacheFallbackPerFile     bool                `mapstructure:"cache_fallback_per_file"`
+	InstallFromFile          bool                `mapstructure:"install_from_file"`
+	TrimFreeSpace            bool                `mapstructure:"trim_free_space"`
+	TransportMethod          string              `mapstructure:"transport_method"`
+	preseedSelections        []string
+	ctx                      interpolate.Context
+}
+
+type OriginPin struct {
+	Origin   string `mapstructure:"origin"`
+	Priority int    `mapstructure:"priority"`
+}
+
+type Preference struct {
+	Package     string `mapstructure:"package"`
+	Pin         string `mapstructure:"pin"`
+	PinPriority int    `mapstructure:"pin_priority"`
+}
+
+type RawPackageIndex struct {
+	BaseURL  string `mapstructure:"base_url"`
+	IndexURL string `mapstructure:"index_url"`
+	Trusted  bool   `mapstructure:"trusted"`
+}
+
+type QuickSource struct {
+	Mirror     string   `mapstructure:"mirror"`
+	Suites     []string `mapstructure:"suites"`
+	Components []string `mapstructure:"components"`
+}
+
+type Deb822Source struct {
+	Types             []string `mapstructure:"types"`
+	URIs              []string `mapstructure:"uris"`
+	Suites            []string `mapstructure:"suites"`
+	Components        []string `mapstructure:"components"`
+	SignedBy          string   `mapstructure:"signed_by"`
+	SnapshotTimestamp string   `mapstructure:"snapshot_timestamp"`
+	CheckValidUntil   *bool    `mapstructure:"check_valid_until"`
+}
+
+type GitHubReleaseDeb struct {
+	Repo         string `mapstructure:"repo"`
+	Tag          string `mapstructure:"tag"`
+	AssetPattern string `mapstructure:"asset_pattern"`
 }
 
 func (c *Config) Prepare(raws ...interface{}) error {
@@ -29,5 +223,599 @@ func (c *Config) Prepare(raws ...interface{}) error {
 		c.CacheDir = "/var/cache/apt/archives"
 	}
 
+	if c.SourcesListDir == "" {
+		c.SourcesListDir = "/etc/apt/sources.list.d"
+	}
+
+	if c.SourcesFilename == "" {
+		c.SourcesFilename = "packer.list"
+	}
+
+	if c.KeyFileMode == "" {
+		c.KeyFileMode = "0644"
+	}
+
+	if c.KeyDownloadTimeout == 0 {
+		c.KeyDownloadTimeout = 30 * time.Second
+	}
+
+	if c.RebootTimeout == 0 {
+		c.RebootTimeout = 5 * time.Minute
+	}
+
+	if c.FixBrokenAttempts == 0 {
+		c.FixBrokenAttempts = 1
+	}
+
+	if c.Frontend == "" {
+		c.Frontend = "apt-get"
+	}
+
+	if c.RetryTries == 0 {
+		c.RetryTries = 1
+	}
+
+	if c.RetryDelay == 0 {
+		c.RetryDelay = 5 * time.Second
+	}
+
+	if c.SudoCommand == "" {
+		c.SudoCommand = "sudo -n"
+	}
+
+	if c.UnmetPolicy == "" {
+		c.UnmetPolicy = "fix-broken"
+	}
+
+	if c.DefaultKeyserver == "" {
+		c.DefaultKeyserver = "hkps://keyserver.ubuntu.com"
+	}
+
+	if len(c.Keyservers) == 0 {
+		c.Keyservers = []string{c.DefaultKeyserver}
+	}
+
+	if c.UploadConcurrency == 0 {
+		c.UploadConcurrency = 4
+	}
+
+	if c.KeyserverTimeout == 0 {
+		c.KeyserverTimeout = 30 * time.Second
+	}
+
+	if c.Upgrade == "" {
+		c.Upgrade = "none"
+	}
+
+	if c.PartialInstallPolicy == "" {
+		c.PartialInstallPolicy = "fail"
+	}
+
+	if c.UpgradeOrder == "" {
+		c.UpgradeOrder = "before"
+	}
+
+	if len(c.DNSProbeHost) == 0 {
+		c.DNSProbeHost = []string{"deb.debian.org"}
+	}
+
+	if c.SlimImagePaths == nil {
+		c.SlimImagePaths = defaultSlimImagePaths
+	}
+
+	if c.WaitForDNS == config.TriUnset {
+		c.WaitForDNS = config.TriTrue
+	}
+
+	if c.SanitizeGuestCache == config.TriUnset {
+		c.SanitizeGuestCache = config.TriTrue
+	}
+
+	var errs *packer.MultiError
+
+	if c.KeyDownloadRetries < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("key_download_retries must not be negative"))
+	}
+
+	if _, ok := frontends[c.Frontend]; !ok {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("frontend must be one of apt-get, apt or nala: %q", c.Frontend))
+	} else if c.Frontend == "nala" && (c.ProgressFd || c.ReportKeptBack || c.FailOnKeptBack) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("progress_fd, report_kept_back and fail_on_kept_back need the apt-get or apt frontend"))
+	} else if c.Frontend == "nala" && (c.AllowReleaseinfoChange || c.DryRun) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("allow_releaseinfo_change and dry_run need the apt-get or apt frontend"))
+	}
+
+	if c.RetryTries < 1 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("retry_tries must be at least 1: %d", c.RetryTries))
+	}
+
+	if c.RetryDelay < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("retry_delay must not be negative"))
+	}
+
+	if c.MirrorCheckRetries < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("mirror_check_retries must not be negative"))
+	}
+
+	if c.MirrorCheckTimeout < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("mirror_check_timeout must not be negative"))
+	}
+
+	if mode, err := strconv.ParseUint(c.KeyFileMode, 8, 32); err != nil || mode > 0777 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("key_file_mode must be an octal file mode: %q", c.KeyFileMode))
+	}
+
+	if c.Umask != "" {
+		if mask, err := strconv.ParseUint(c.Umask, 8, 32); err != nil || mask > 0777 {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("umask must be an octal mask: %q", c.Umask))
+		}
+	}
+
+	if !path.IsAbs(c.SourcesListDir) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("sources_list_dir must be an absolute path: %q", c.SourcesListDir))
+	}
+
+	if strings.ContainsAny(c.SourcesFilename, `/\`) || c.SourcesFilename == ".list" || path.Ext(c.SourcesFilename) != ".list" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("sources_filename must be a file name ending in .list: %q", c.SourcesFilename))
+	}
+
+	for _, units := range [][]string{c.EnableServices, c.DisableServices, c.MaskServices} {
+		for _, unit := range units {
+			if !unitNameRe.MatchString(unit) {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid systemd unit name: %q", unit))
+			}
+		}
+	}
+
+	for _, pin := range c.OriginPins {
+		if pin.Origin == "" || strings.ContainsAny(pin.Origin, " \t\n") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid origin pin origin: %q", pin.Origin))
+		}
+		if pin.Priority == 0 {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("origin pin for %q needs a non-zero priority", pin.Origin))
+		}
+	}
+
+	for _, pref := range c.Preferences {
+		if err := pref.validate(); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("preferences: %v", err))
+		}
+	}
+
+	for pkg, excluded := range c.ExcludeDependencies {
+		for _, name := range append([]string{pkg}, excluded...) {
+			if !packageNameRe.MatchString(name) {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid package name in exclude_dependencies: %q", name))
+			}
+		}
+	}
+
+	if c.PackagesFile != "" {
+		install, remove, err := readPackagesFile(c.PackagesFile)
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("packages_file: %v", err))
+		}
+		c.Packages = append(c.Packages, install...)
+		c.Remove = append(c.Remove, remove...)
+	}
+
+	if c.Aptfile != "" {
+		packages, sources, err := readAptfile(c.Aptfile)
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("aptfile: %v", err))
+		}
+		c.Packages = appendUnique(c.Packages, packages...)
+		c.Sources = append(c.Sources, sources...)
+	}
+
+	c.preseedSelections = nil
+	if c.PreseedFile != "" {
+		selections, err := readPreseedFile(c.PreseedFile)
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("preseed_file: %v", err))
+		}
+		c.preseedSelections = append(c.preseedSelections, selections...)
+	}
+	for _, line := range c.Preseed {
+		if _, _, err := parseSelection(line); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("preseed: %v", err))
+			continue
+		}
+		c.preseedSelections = append(c.preseedSelections, strings.TrimSpace(line))
+	}
+	for _, line := range c.preseedSelections {
+		if typ, value, _ := parseSelection(line); typ == "password" && value != "" {
+			packer.LogSecretFilter.Set(value)
+		}
+	}
+
+	if c.ListsCacheDir != "" {
+		if fi, err := os.Stat(c.ListsCacheDir); err != nil || !fi.IsDir() {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("lists_cache_dir must be an existing directory: %q", c.ListsCacheDir))
+		}
+	}
+
+	if c.CommandPrefix != "" && strings.TrimSpace(c.CommandPrefix) == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("command_prefix must not be blank"))
+	}
+
+	if c.FixBrokenAttempts < 1 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("fix_broken_attempts must be at least 1: %d", c.FixBrokenAttempts))
+	}
+
+	if strings.TrimSpace(c.SudoCommand) == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("sudo_command must not be blank"))
+	}
+
+	if c.DNSTestCommand != "" && strings.TrimSpace(c.DNSTestCommand) == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("dns_test_command must not be blank"))
+	}
+
+	if c.MinAptVersion != "" && !versionRe.MatchString(c.MinAptVersion) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid min_apt_version: %q", c.MinAptVersion))
+	}
+
+	for _, group := range c.InstallGroupsSelected {
+		packages, ok := c.PackageGroups[group]
+		if !ok {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("install_groups_selected: unknown package group %q", group))
+			continue
+		}
+		c.Packages = appendUnique(c.Packages, packages...)
+	}
+
+	for _, pkg := range c.Packages {
+		if !packageSpecRe.MatchString(pkg) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("packages: invalid package entry %q", pkg))
+		}
+	}
+
+	if strings.ContainsAny(c.DefaultRelease, " \t\n\"';") {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid default_release: %q", c.DefaultRelease))
+	}
+
+	for _, deb := range c.DebFiles {
+		if filepath.Ext(deb) != ".deb" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("deb_files: not a .deb file: %q", deb))
+		} else if _, err := os.Stat(deb); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("deb_files: %v", err))
+		}
+	}
+
+	for _, index := range c.RawPackageIndexes {
+		source, err := index.source()
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("raw_package_indexes: %v", err))
+			continue
+		}
+		c.Sources = append(c.Sources, source)
+	}
+
+	if c.QuickSource.Mirror != "" || len(c.QuickSource.Suites) != 0 || len(c.QuickSource.Components) != 0 {
+		sources, err := c.QuickSource.sources()
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("quick_source: %v", err))
+		} else {
+			c.Sources = append(c.Sources, sources...)
+		}
+	}
+
+	for _, arch := range c.Architectures {
+		if !containsString(debianArchitectures, arch) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("architectures: unknown architecture %q, must be one of %s",
+				arch, strings.Join(debianArchitectures, ", ")))
+		}
+	}
+
+	seenSources := make(map[string]bool, len(c.Sources))
+	for _, source := range c.Sources {
+		if err := validateSourceLine(source); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("sources: %v: %q", err, source))
+			continue
+		}
+		if seenSources[source] {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("sources: duplicate line: %q", source))
+		}
+		seenSources[source] = true
+	}
+
+	keyPaths := c.keyPaths()
+	for i := range c.Deb822Sources {
+		source := &c.Deb822Sources[i]
+		if len(source.Types) == 0 {
+			source.Types = []string{"deb"}
+		}
+		if err := source.validate(); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("deb822_sources: %v", err))
+		} else if source.SnapshotTimestamp != "" {
+			if err := source.pinSnapshot(); err != nil {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("deb822_sources: %v", err))
+			}
+		}
+		if source.SignedBy != "" && !containsString(keyPaths, source.SignedBy) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("deb822_sources: signed_by is not the path of one of keys: %q", source.SignedBy))
+		}
+	}
+
+	switch c.UnmetPolicy {
+	case "fix-broken", "unpin":
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("unmet_policy must be one of fix-broken or unpin: %q", c.UnmetPolicy))
+	}
+
+	if u, err := url.Parse(c.DefaultKeyserver); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("default_keyserver must be a keyserver URL: %q", c.DefaultKeyserver))
+	}
+	for _, keyserver := range c.Keyservers {
+		if u, err := url.Parse(keyserver); err != nil || u.Scheme == "" || u.Host == "" || strings.Contains(keyserver, "'") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("keyservers: not a keyserver URL: %q", keyserver))
+		}
+	}
+	for _, v := range c.EnvironmentVars {
+		if !envVarRe.MatchString(v) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("environment_vars: not a KEY=value assignment: %q", v))
+		}
+	}
+	if c.UploadConcurrency < 1 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("upload_concurrency must be at least 1"))
+	}
+	if c.MaxRemovals < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("max_removals must not be negative"))
+	}
+	if c.KeyserverRetries < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("keyserver_retries must not be negative"))
+	}
+	if c.KeyserverTimeout < time.Second {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("keyserver_timeout must be at least 1s"))
+	}
+
+	if _, ok := upgradeCommands[c.Upgrade]; !ok && c.Upgrade != "none" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("upgrade must be one of none, safe or full: %q", c.Upgrade))
+	}
+
+	switch c.UpgradeOrder {
+	case "before", "after":
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("upgrade_order must be one of before or after: %q", c.UpgradeOrder))
+	}
+
+	if c.MaxDownloadsPerHost < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("max_downloads_per_host must not be negative"))
+	}
+
+	if c.GitHubToken != "" {
+		packer.LogSecretFilter.Set(c.GitHubToken)
+	}
+
+	for _, option := range []struct{ name, proxy string }{{"proxy", c.Proxy}, {"https_proxy", c.HTTPSProxy}} {
+		name, proxy := option.name, option.proxy
+		if proxy == "" {
+			continue
+		}
+		u, err := url.Parse(proxy)
+		if err != nil || !(u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "socks5h") || u.Host == "" ||
+			strings.ContainsAny(proxy, "\" \t\n") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("%s must be an http, https or socks5h URL: %q", name, proxy))
+			continue
+		}
+		if password, ok := u.User.Password(); ok {
+			packer.LogSecretFilter.Set(password)
+		}
+	}
+
+	for i := range c.GitHubReleaseDebs {
+		d := &c.GitHubReleaseDebs[i]
+		if d.Tag == "" {
+			d.Tag = "latest"
+		}
+		if !githubRepoRe.MatchString(d.Repo) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("github_release_debs: repo must be owner/name: %q", d.Repo))
+		}
+		if strings.ContainsAny(d.Tag, " \t\n") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("github_release_debs: invalid tag for %s: %q", d.Repo, d.Tag))
+		}
+		if _, err := path.Match(d.AssetPattern, ""); err != nil || d.AssetPattern == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("github_release_debs: invalid asset_pattern for %s: %q", d.Repo, d.AssetPattern))
+		}
+	}
+
+	switch c.PartialInstallPolicy {
+	case "fail", "warn":
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("partial_install_policy must be one of fail or warn: %q", c.PartialInstallPolicy))
+	}
+
+	for _, glob := range c.SlimImagePaths {
+		if !path.IsAbs(glob) || strings.ContainsAny(glob, " \t\n;&|'\"$`") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("slim_image_paths must be absolute paths or globs: %q", glob))
+		}
+	}
+
+	var sourceURIs []string
+	for _, source := range c.sourceLines() {
+		sourceURIs = append(sourceURIs, probeURI(source))
+	}
+	for key, pkg := range c.SourceProbes {
+		if !containsString(sourceURIs, probeURI(key)) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("source_probes: not one of sources: %q", key))
+		}
+		if !packageNameRe.MatchString(pkg) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("source_probes: invalid probe package for %s: %q", key, pkg))
+		}
+	}
+
+	// source_probes name the sources as configured, so the URIs are only
+	// rewritten for the transport method once the probes are validated.
+	if c.TransportMethod != "" {
+		if _, ok := transportMethods[c.TransportMethod]; !ok {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("transport_method must be one of %s: %q",
+				strings.Join(transportMethodNames(), ", "), c.TransportMethod))
+		} else {
+			c.applyTransportMethod()
+		}
+		if c.TransportMethod == "tor" && c.RequireNetwork {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("require_network can't check sources fetched through tor"))
+		}
+	}
+
+	if c.InstallQemuUserStatic && !c.EnsureQemuUserStatic {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("install_qemu_user_static needs ensure_qemu_user_static"))
+	}
+
+	if c.RequireNetwork && len(releaseURLs(c.sourceLines())) == 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("require_network needs at least one http or https source"))
+	}
+
+	if c.DKMSKernelVersion != "" && !kernelRe.MatchString(c.DKMSKernelVersion) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("dkms_kernel_version must be a kernel release like 6.1.0-18-amd64: %q", c.DKMSKernelVersion))
+	}
+
+	for _, device := range c.GrubInstallDevices {
+		if !devicePathRe.MatchString(device) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("grub_install_devices: not a device path: %q", device))
+		}
+	}
+
+	for _, arg := range c.ExtraArguments {
+		if !argumentRe.MatchString(arg) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("extra_arguments: argument is empty or contains shell metacharacters: %q", arg))
+		}
+	}
+	if c.GuardCacheOrder && !c.WritebackCache.False() {
+		if err := c.validateCacheOrder(); err != nil {
+			errs = packer.MultiErrorAppend(errs, err)
+		}
+	}
+
+	for _, host := range c.DNSProbeHost {
+		if !hostnameRe.MatchString(host) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid dns_probe_host: %q", host))
+		}
+	}
+
+	errs = c.validateFailPhases(errs)
+
+	if _, ok := solverPackages[c.Solver]; !ok && c.Solver != "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("solver must be one of internal, apt, aspcud or mccs: %q", c.Solver))
+	}
+
+	if c.RebootTimeout < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("reboot_timeout must not be negative"))
+	}
+
+	if c.PerPackageTimeout < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("per_package_timeout must not be negative"))
+	}
+
+	if c.AptLocale != "" && !localeRe.MatchString(c.AptLocale) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid apt_locale: %q", c.AptLocale))
+	}
+
+	for _, pkg := range sortedStringKeys(c.VersionRanges) {
+		if !packageNameRe.MatchString(pkg) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("version_ranges: invalid package name: %q", pkg))
+		}
+		if !versionGlobRe.MatchString(c.VersionRanges[pkg]) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("version_ranges: invalid version glob for %s: %q", pkg, c.VersionRanges[pkg]))
+		}
+		for _, spec := range c.Packages {
+			if packageName(spec) == pkg && spec != pkg {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("version_ranges: %s conflicts with version range %s", spec, c.VersionRanges[pkg]))
+			}
+		}
+		c.Packages = appendUnique(c.Packages, pkg)
+	}
+
+	for _, pkg := range c.Hold {
+		if !packageSpecRe.MatchString(pkg) || pkg != packageName(pkg) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("hold: invalid package name: %q", pkg))
+		}
+	}
+
+	for _, pkg := range append(append([]string(nil), c.Remove...), c.Purge...) {
+		if !packageSpecRe.MatchString(pkg) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid package in remove or purge: %q", pkg))
+		}
+	}
+
+	if c.SecurityBaseline {
+		if c.SecurityBaselinePackages == nil {
+			c.SecurityBaselinePackages = defaultSecurityBaselinePackages
+		}
+		for _, pkg := range c.SecurityBaselinePackages {
+			if !packageSpecRe.MatchString(pkg) {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid package in security_baseline_packages: %q", pkg))
+			}
+		}
+		c.Packages = appendUnique(c.Packages, c.SecurityBaselinePackages...)
+	}
+
+	if c.VerifyDebsums {
+		c.Packages = appendUnique(c.Packages, "debsums")
+	}
+
+	if c.LockfileIn != "" {
+		versions, err := readLockfile(c.LockfileIn)
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("lockfile_in: %v", err))
+		} else if c.Packages, err = pinPackages(c.Packages, versions); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("lockfile_in: %v", err))
+		}
+	}
+
+	// Armored keys are installed as .gpg, so name.asc and name.gpg collide.
+	keyNames := make(map[string]string)
+	for _, key := range c.Keys {
+		if isKeyURL(key) {
+			if base := keyFileName(key); base == "." || base == "/" {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("keys: URL has no file name to install the key under: %q", key))
+				continue
+			}
+		} else if _, err := os.Stat(key); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("keys: neither a URL nor an existing file: %q", key))
+			continue
+		}
+		name := keyFileName(key)
+		if strings.HasSuffix(name, ".asc") {
+			name = strings.TrimSuffix(name, ".asc") + ".gpg"
+		}
+		if other, ok := keyNames[name]; ok {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("keys %q and %q would be installed under the same name %s", other, key, name))
+			continue
+		}
+		keyNames[name] = key
+	}
+
+	for key, fpr := range c.KeyFingerprints {
+		if !isKeyURL(key) || !containsString(c.Keys, key) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("key_fingerprints: not a key URL in keys: %q", key))
+		}
+		if !fingerprintRe.MatchString(normalizeFingerprint(fpr)) {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("key_fingerprints: invalid fingerprint for %s: %q", key, fpr))
+		}
+	}
+
+	if len(c.Packages) == 0 {
+		log.Printf("[WARN] apt: packages is empty, no packages will be installed")
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
 	return nil
 }
+
+// aptLocale returns the locale apt commands run in. Features that parse apt
+// output default to the C locale, so that messages aren't translated.
+func (c *Config) aptLocale() string {
+	if c.AptLocale != "" {
+		return c.AptLocale
+	}
+	if c.ProgressFd || c.AssertConsistent || c.AutoResolveUnmet || c.AutoFetchMissingKeys ||
+		c.ReportKeptBack || c.FailOnKeptBack || c.VerifyDebsums || c.SkipNewerInstalled || c.PartialInstallPolicy == "warn" ||
+		len(c.SourceProbes) != 0 {
+		return "C"
+	}
+	return ""
+}
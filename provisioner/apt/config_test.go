@@ -0,0 +1,76 @@
+package apt
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// prepare runs Prepare on raw, returning the error message, or "" when the
+// configuration is valid.
+func prepare(t *testing.T, raw map[string]interface{}) (*Provisioner, string) {
+	t.Helper()
+	var p Provisioner
+	if err := p.Prepare(raw); err != nil {
+		return &p, err.Error()
+	}
+	return &p, ""
+}
+
+func TestPrepareKeys(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "example.gpg")
+	if err := ioutil.WriteFile(key, []byte("key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		err  string
+	}{
+		{name: "existing file", raw: map[string]interface{}{"keys": []string{key}}},
+		{name: "URL", raw: map[string]interface{}{"keys": []string{"https://example.com/key.asc"}}},
+		{
+			name: "missing file",
+			raw:  map[string]interface{}{"keys": []string{filepath.Join(dir, "missing.gpg")}},
+			err:  "keys: neither a URL nor an existing file",
+		},
+		{
+			name: "missing file in strict mode",
+			raw:  map[string]interface{}{"keys": []string{filepath.Join(dir, "missing.gpg")}, "strict": true},
+			err:  "keys: neither a URL nor an existing file",
+		},
+		{
+			name: "URL without a file name",
+			raw:  map[string]interface{}{"keys": []string{"https://example.com/"}},
+			err:  "keys: URL has no file name",
+		},
+		{
+			name: "same file name",
+			raw:  map[string]interface{}{"keys": []string{key, "https://example.com/example.gpg"}},
+			err:  `would be installed under the same name example.gpg`,
+		},
+		{
+			name: "armored and binary collide",
+			raw:  map[string]interface{}{"keys": []string{"https://example.com/a/example.asc", "https://example.com/b/example.gpg"}},
+			err:  `keys "https://example.com/a/example.asc" and "https://example.com/b/example.gpg" would be installed under the same name example.gpg`,
+		},
+		{
+			name: "different names",
+			raw:  map[string]interface{}{"keys": []string{key, "https://example.com/other.asc"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prepare(t, tt.raw)
+			if tt.err == "" && err != "" {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !strings.Contains(err, tt.err) {
+				t.Fatalf("expected error containing %q, got %q", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package apt
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// checkValidUntil returns the Check-Valid-Until value of the stanza, or ""
+// to leave apt's default. Snapshots are frozen, so their Release files
+// expire and are never checked.
+func (s Deb822Source) checkValidUntil() string {
+	switch {
+	case s.SnapshotTimestamp != "":
+		return "no"
+	case s.CheckValidUntil == nil:
+		return ""
+	case *s.CheckValidUntil:
+		return "yes"
+	}
+	return "no"
+}
+
+// lines returns the one-line sources equivalent to the stanza, one for each
+// type, URI and suite, so that the checks on sources cover it too.
+func (s Deb822Source) lines() []string {
+	var opts []string
+	if s.SignedBy != "" {
+		opts = append(opts, "signed-by="+s.SignedBy)
+	}
+	if value := s.checkValidUntil(); value != "" {
+		opts = append(opts, "check-valid-until="+value)
+	}
+	options := ""
+	if len(opts) != 0 {
+		options = "[" + strings.Join(opts, " ") + "] "
+	}
+	var lines []string
+	for _, typ := range s.Types {
+		for _, uri := range s.URIs {
+			for _, suite := range s.Suites {
+				lines = append(lines, strings.TrimSpace(fmt.Sprintf("%s %s%s %s %s",
+					typ, options, uri, suite, strings.Join(s.Components, " "))))
+			}
+		}
+	}
+	return lines
+}
+
+func (s Deb822Source) validate() error {
+	for _, typ := range s.Types {
+		if typ != "deb" && typ != "deb-src" {
+			return fmt.Errorf("types must be deb or deb-src: %q", typ)
+		}
+	}
+	if len(s.URIs) == 0 || len(s.Suites) == 0 {
+		return fmt.Errorf("uris and suites are required")
+	}
+	for _, field := range [][]string{s.URIs, s.Suites, s.Components} {
+		for _, value := range field {
+			if value == "" || strings.ContainsAny(value, " \t\n") {
+				return fmt.Errorf("invalid value: %q", value)
+			}
+		}
+	}
+	for _, suite := range s.Suites {
+		if strings.HasSuffix(suite, "/") != (len(s.Components) == 0) {
+			return fmt.Errorf("components are required unless the suite %q is an exact path ending in /", suite)
+		}
+	}
+	if s.SnapshotTimestamp != "" && s.CheckValidUntil != nil && *s.CheckValidUntil {
+		return fmt.Errorf("check_valid_until can't be true for a snapshot, its Release file expires")
+	}
+	return nil
+}
+
+// renderDeb822Sources renders the stanzas of a sources.list(5) .sources file.
+func renderDeb822Sources(sources []Deb822Source) string {
+	var stanzas []string
+	for _, s := range sources {
+		stanza := fmt.Sprintf("Types: %s\nURIs: %s\nSuites: %s\n",
+			strings.Join(s.Types, " "), strings.Join(s.URIs, " "), strings.Join(s.Suites, " "))
+		if len(s.Components) != 0 {
+			stanza += "Components: " + strings.Join(s.Components, " ") + "\n"
+		}
+		if s.SignedBy != "" {
+			stanza += "Signed-By: " + s.SignedBy + "\n"
+		}
+		if value := s.checkValidUntil(); value != "" {
+			stanza += "Check-Valid-Until: " + value + "\n"
+		}
+		stanzas = append(stanzas, stanza)
+	}
+	return strings.Join(stanzas, "\n")
+}
+
+// deb822FileName returns the name of the .sources file, which shares its
+// base name with sources_filename.
+func (c *Config) deb822FileName() string {
+	return strings.TrimSuffix(c.SourcesFilename, ".list") + ".sources"
+}
+
+// sourceLines returns the one-line sources together with the equivalents of
+// the deb822 sources.
+func (c *Config) sourceLines() []string {
+	lines := append([]string(nil), c.Sources...)
+	for _, s := range c.Deb822Sources {
+		lines = append(lines, s.lines()...)
+	}
+	return lines
+}
+
+// keyPaths returns the guest paths the configured keys are uploaded to.
+// Armored keys are installed as .gpg, so both names are accepted.
+func (c *Config) keyPaths() []string {
+	dirs := []string{trustedKeysDir}
+	if c.DualKeyInstall {
+		dirs = append(dirs, keyringsDir)
+	}
+	var paths []string
+	for _, key := range c.Keys {
+		name := keyFileName(key)
+		for _, dir := range dirs {
+			paths = append(paths, path.Join(dir, name), path.Join(dir, strings.TrimSuffix(name, ".asc")+".gpg"))
+		}
+	}
+	return paths
+}
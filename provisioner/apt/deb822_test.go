@@ -0,0 +1,113 @@
+package apt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderDeb822Sources(t *testing.T) {
+	no, yes := false, true
+	tests := []struct {
+		name   string
+		source Deb822Source
+		want   string
+		lines  []string
+	}{
+		{
+			name: "signed",
+			source: Deb822Source{
+				Types:      []string{"deb"},
+				URIs:       []string{"https://download.docker.com/linux/debian"},
+				Suites:     []string{"bookworm"},
+				Components: []string{"stable"},
+				SignedBy:   "/etc/apt/trusted.gpg.d/docker.gpg",
+			},
+			want: "Types: deb\nURIs: https://download.docker.com/linux/debian\nSuites: bookworm\nComponents: stable\nSigned-By: /etc/apt/trusted.gpg.d/docker.gpg\n",
+			lines: []string{
+				"deb [signed-by=/etc/apt/trusted.gpg.d/docker.gpg] https://download.docker.com/linux/debian bookworm stable",
+			},
+		},
+		{
+			name: "stale repository",
+			source: Deb822Source{
+				Types:           []string{"deb", "deb-src"},
+				URIs:            []string{"http://archive.example.com/debian"},
+				Suites:          []string{"stable"},
+				Components:      []string{"main"},
+				CheckValidUntil: &no,
+			},
+			want: "Types: deb deb-src\nURIs: http://archive.example.com/debian\nSuites: stable\nComponents: main\nCheck-Valid-Until: no\n",
+			lines: []string{
+				"deb [check-valid-until=no] http://archive.example.com/debian stable main",
+				"deb-src [check-valid-until=no] http://archive.example.com/debian stable main",
+			},
+		},
+		{
+			name: "checked repository",
+			source: Deb822Source{
+				Types:           []string{"deb"},
+				URIs:            []string{"http://archive.example.com/debian"},
+				Suites:          []string{"./"},
+				CheckValidUntil: &yes,
+			},
+			want:  "Types: deb\nURIs: http://archive.example.com/debian\nSuites: ./\nCheck-Valid-Until: yes\n",
+			lines: []string{"deb [check-valid-until=yes] http://archive.example.com/debian ./"},
+		},
+		{
+			name: "snapshot",
+			source: Deb822Source{
+				Types:             []string{"deb"},
+				URIs:              []string{"https://snapshot.debian.org/archive/debian/20240101T000000Z/"},
+				Suites:            []string{"bookworm"},
+				Components:        []string{"main"},
+				SnapshotTimestamp: "20240101T000000Z",
+			},
+			want:  "Types: deb\nURIs: https://snapshot.debian.org/archive/debian/20240101T000000Z/\nSuites: bookworm\nComponents: main\nCheck-Valid-Until: no\n",
+			lines: []string{"deb [check-valid-until=no] https://snapshot.debian.org/archive/debian/20240101T000000Z/ bookworm main"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.source.validate(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := renderDeb822Sources([]Deb822Source{tt.source}); got != tt.want {
+				t.Errorf("rendered:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if got := tt.source.lines(); !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("lines %q, want %q", got, tt.lines)
+			}
+			for _, line := range tt.source.lines() {
+				if err := validateSourceLine(line); err != nil {
+					t.Errorf("invalid line %q: %v", line, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeb822SourceValidate(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name   string
+		source Deb822Source
+		err    string
+	}{
+		{"bad type", Deb822Source{Types: []string{"rpm"}, URIs: []string{"http://x"}, Suites: []string{"a"}, Components: []string{"main"}}, "types must be deb or deb-src"},
+		{"no uris", Deb822Source{Types: []string{"deb"}, Suites: []string{"a"}}, "uris and suites are required"},
+		{"blank component", Deb822Source{Types: []string{"deb"}, URIs: []string{"http://x"}, Suites: []string{"a"}, Components: []string{""}}, "invalid value"},
+		{"missing components", Deb822Source{Types: []string{"deb"}, URIs: []string{"http://x"}, Suites: []string{"a"}}, "components are required"},
+		{"components with exact path", Deb822Source{Types: []string{"deb"}, URIs: []string{"http://x"}, Suites: []string{"./"}, Components: []string{"main"}}, "components are required"},
+		{
+			"checked snapshot",
+			Deb822Source{Types: []string{"deb"}, URIs: []string{"http://x"}, Suites: []string{"a"}, Components: []string{"main"}, SnapshotTimestamp: "20240101T000000Z", CheckValidUntil: &yes},
+			"check_valid_until can't be true for a snapshot",
+		},
+	}
+	for _, tt := range tests {
+		if err := tt.source.validate(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
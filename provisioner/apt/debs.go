@@ -0,0 +1,55 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const remoteDebDir = "/tmp/packer-apt-debs"
+
+// installRemoteDebs uploads local .deb files and installs them, letting apt
+// (or gdebi) resolve their dependencies from the configured sources.
+func (p *Provisioner) installRemoteDebs(ctx context.Context, ui packer.Ui, comm packer.Communicator, debs []string) error {
+	if len(debs) == 0 {
+		return nil
+	}
+
+	if err := runRemoteCommand(ctx, ui, comm, "/bin/mkdir -p "+remoteDebDir); err != nil {
+		return err
+	}
+
+	var remote []string
+	for _, deb := range debs {
+		dst := path.Join(remoteDebDir, filepath.Base(deb))
+		ui.Say(fmt.Sprintf("Uploading %s", deb))
+		if err := uploadFile(comm, deb, dst); err != nil {
+			return fmt.Errorf("failed to upload %s: %v", deb, err)
+		}
+		remote = append(remote, dst)
+	}
+
+	var commands []string
+	if p.config.DryRun {
+		// gdebi can't simulate, and installing it would change the image.
+		commands = append(commands, p.aptCommand(noninteractive, "/usr/bin/apt-get install -s -y --no-install-recommends "+strings.Join(remote, " ")))
+	} else if p.config.UseGdebi {
+		commands = append(commands, p.aptCommand(noninteractive, "/usr/bin/apt-get install -y --no-install-recommends gdebi-core"))
+		for _, deb := range remote {
+			commands = append(commands, p.aptCommand(noninteractive, "/usr/bin/gdebi -n "+deb))
+		}
+	} else {
+		commands = append(commands, p.aptCommand(noninteractive, "/usr/bin/apt-get install -y --no-install-recommends "+strings.Join(remote, " ")))
+	}
+	for _, command := range commands {
+		if err := runRemoteCommand(ctx, ui, comm, command); err != nil {
+			return err
+		}
+	}
+
+	return removeRemoteFiles(ctx, ui, comm, []string{remoteDebDir})
+}
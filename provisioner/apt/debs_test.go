@@ -0,0 +1,55 @@
+package apt
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestInstallRemoteDebs(t *testing.T) {
+	deb := filepath.Join(t.TempDir(), "tool_1.0_amd64.deb")
+	if err := ioutil.WriteFile(deb, []byte("deb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		gdebi   bool
+		fail    string
+		install string
+		err     bool
+	}{
+		{name: "apt", install: "/usr/bin/apt-get install -y --no-install-recommends /tmp/packer-apt-debs/tool_1.0_amd64.deb"},
+		{name: "gdebi", gdebi: true, install: "/usr/bin/gdebi -n /tmp/packer-apt-debs/tool_1.0_amd64.deb"},
+		{name: "failed mkdir", fail: "/bin/mkdir", err: true},
+		{name: "failed apt install", fail: "/usr/bin/apt-get install", err: true},
+		{name: "failed gdebi install", gdebi: true, fail: "/usr/bin/gdebi", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm := &fakeComm{status: failing(tt.fail)}
+			p := &Provisioner{config: Config{UseGdebi: tt.gdebi}}
+
+			err := p.installRemoteDebs(context.Background(), packer.TestUi(t), comm, []string{deb})
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error when %s fails", tt.fail)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok := comm.uploads["/tmp/packer-apt-debs/tool_1.0_amd64.deb"]; !ok {
+				t.Errorf("deb not uploaded, uploads: %v", comm.uploads)
+			}
+			if !strings.Contains(strings.Join(comm.commands, "\n"), tt.install) {
+				t.Errorf("no %q in commands:\n%s", tt.install, strings.Join(comm.commands, "\n"))
+			}
+		})
+	}
+}
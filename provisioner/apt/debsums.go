@@ -0,0 +1,63 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// parseDebsums splits the output of debsums -s into files whose checksums
+// don't match or that are missing, and packages that ship no checksums.
+func parseDebsums(output string) (mismatches []string, unchecked []string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "debsums: ")
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "no md5sums for "):
+			unchecked = append(unchecked, strings.TrimPrefix(line, "no md5sums for "))
+		case strings.HasPrefix(line, "changed file "), strings.HasPrefix(line, "missing file "):
+			mismatches = append(mismatches, line)
+		}
+	}
+	return mismatches, unchecked
+}
+
+// debsumsChanged is the exit status debsums reports changed or missing files
+// with. Any other non-zero status is an error of debsums itself.
+const debsumsChanged = 2
+
+// verifyRemoteDebsums checks the installed files against their package
+// checksums, listing every file that doesn't match.
+func (p *Provisioner) verifyRemoteDebsums(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if _, err := runRemoteOutput(ctx, comm, "/usr/bin/test -x /usr/bin/debsums"); err != nil {
+		return fmt.Errorf("debsums is not installed on the guest")
+	}
+
+	ui.Say("Verifying installed files with debsums")
+	var output syncBuffer
+	cmd := &packer.RemoteCmd{
+		Command: p.aptCommand(nil, "/usr/bin/debsums -s"),
+		Stdout:  &output,
+		Stderr:  &output,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return err
+	}
+	if status := cmd.Wait(); status != 0 && status != debsumsChanged {
+		return fmt.Errorf("debsums exited with status %d: %s", status, outputTail(output.String()))
+	}
+
+	mismatches, unchecked := parseDebsums(output.String())
+	if len(unchecked) != 0 {
+		ui.Say(fmt.Sprintf("Packages without checksums, not verified: %s", strings.Join(unchecked, " ")))
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	for _, mismatch := range mismatches {
+		ui.Error(mismatch)
+	}
+	return fmt.Errorf("debsums found %d files not matching their package", len(mismatches))
+}
@@ -0,0 +1,73 @@
+package apt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestVerifyRemoteDebsums(t *testing.T) {
+	tests := []struct {
+		name   string
+		absent bool
+		status int
+		output string
+		err    string
+	}{
+		{name: "clean", output: "debsums: no md5sums for vendor-tool\n"},
+		{
+			name:   "changed files",
+			status: 2,
+			output: "debsums: changed file /etc/issue (from base-files package)\ndebsums: missing file /usr/bin/tool (from tool package)\n",
+			err:    "debsums found 2 files not matching their package",
+		},
+		{name: "not installed", absent: true, err: "debsums is not installed"},
+		{name: "debsums error", status: 1, output: "debsums: can't open nope\n", err: "debsums exited with status 1: debsums: can't open nope"},
+		{name: "invalid option", status: 255, err: "debsums exited with status 255"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm := &fakeComm{
+				status: func(command string) int {
+					if strings.Contains(command, "test -x") {
+						if tt.absent {
+							return 1
+						}
+						return 0
+					}
+					return tt.status
+				},
+				output: func(command string) string {
+					if strings.Contains(command, "debsums -s") {
+						return tt.output
+					}
+					return ""
+				},
+			}
+			p := &Provisioner{}
+
+			err := p.verifyRemoteDebsums(context.Background(), packer.TestUi(t), comm)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestParseDebsums(t *testing.T) {
+	mismatches, unchecked := parseDebsums(`debsums: changed file /etc/issue (from base-files package)
+debsums: no md5sums for vendor-tool
+debsums: missing file /usr/bin/tool (from tool package)
+`)
+	if len(mismatches) != 2 || !strings.HasPrefix(mismatches[1], "missing file /usr/bin/tool") {
+		t.Errorf("mismatches %q", mismatches)
+	}
+	if len(unchecked) != 1 || unchecked[0] != "vendor-tool" {
+		t.Errorf("unchecked %q", unchecked)
+	}
+}
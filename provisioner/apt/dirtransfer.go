@@ -0,0 +1,96 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// isUnsupportedTransfer reports whether a communicator failed a directory
+// transfer because it doesn't implement it, as the none communicator does.
+func isUnsupportedTransfer(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not implemented") || strings.Contains(msg, "not supported")
+}
+
+func (p *Provisioner) unsupportedTransfer(ui packer.Ui, err error) error {
+	if !p.config.CacheFallbackPerFile {
+		return fmt.Errorf("communicator does not support directory transfer; set cache_fallback_per_file: %v", err)
+	}
+	ui.Say("The communicator doesn't support directory transfers, copying the files one by one")
+	return nil
+}
+
+// uploadDir uploads the files of the host directory src into the guest
+// directory dst, one by one if the communicator can't upload directories
+// and cache_fallback_per_file is set. Subdirectories are skipped then.
+func (p *Provisioner) uploadDir(ui packer.Ui, comm packer.Communicator, dst string, src string, exclude []string) error {
+	err := comm.UploadDir(dst, src, exclude)
+	if err == nil || !isUnsupportedTransfer(err) {
+		return err
+	}
+	if err := p.unsupportedTransfer(ui, err); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || containsString(exclude, entry.Name()) {
+			continue
+		}
+		if err := uploadFile(comm, filepath.Join(src, entry.Name()), path.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadDir downloads the files of the guest directory src into the host
+// directory dst, one by one if the communicator can't download directories
+// and cache_fallback_per_file is set. Subdirectories are skipped then.
+func (p *Provisioner) downloadDir(ctx context.Context, ui packer.Ui, comm packer.Communicator, src string, dst string, exclude []string) error {
+	err := comm.DownloadDir(src, dst, exclude)
+	if err == nil || !isUnsupportedTransfer(err) {
+		return err
+	}
+	if err := p.unsupportedTransfer(ui, err); err != nil {
+		return err
+	}
+
+	output, err := runRemoteOutput(ctx, comm, fmt.Sprintf("/usr/bin/find '%s' -mindepth 1 -maxdepth 1 -type f -printf '%%f\\n'", src))
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Fields(output) {
+		if containsString(exclude, name) {
+			continue
+		}
+		if err := downloadFile(comm, path.Join(src, name), filepath.Join(dst, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uploadFile(comm packer.Communicator, src string, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return comm.Upload(dst, f, &fi)
+}
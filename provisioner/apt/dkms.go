@@ -0,0 +1,41 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// dkmsAutoinstallCommand builds the DKMS modules of the installed packages
+// for kernel instead of the running kernel.
+func dkmsAutoinstallCommand(kernel string) string {
+	return "/usr/sbin/dkms autoinstall -k " + kernel
+}
+
+func (p *Provisioner) buildRemoteDKMSModules(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	status, err := runRemoteOutput(ctx, comm, "/usr/bin/dpkg-query -W -f '${db:Status-Abbrev}' dkms 2>/dev/null || true")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(status, "ii") && !p.config.Explain {
+		ui.Say("dkms is not installed, no kernel modules to build")
+		return nil
+	}
+
+	if p.config.DryRun {
+		ui.Say(fmt.Sprintf("Dry run, skipping the build of DKMS modules for kernel %s", p.config.DKMSKernelVersion))
+		return nil
+	}
+
+	ui.Say(fmt.Sprintf("Building DKMS modules for kernel %s", p.config.DKMSKernelVersion))
+	cmd := &packer.RemoteCmd{Command: dkmsAutoinstallCommand(p.config.DKMSKernelVersion)}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("dkms autoinstall for kernel %s exited with status %d", p.config.DKMSKernelVersion, status)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const dpkgLog = "/var/log/dpkg.log"
+
+// snapshotDpkgLog remembers the size of dpkg.log, so that only the lines
+// written during the build are captured.
+func (p *Provisioner) snapshotDpkgLog(ctx context.Context, comm packer.Communicator) error {
+	output, err := runRemoteOutput(ctx, comm, fmt.Sprintf("/usr/bin/wc -c < %s 2>/dev/null || echo 0", dpkgLog))
+	if err != nil {
+		return err
+	}
+	p.dpkgLogOffset, _ = strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	return nil
+}
+
+// dpkgLogTailCommand prints dpkg.log from offset on, or the whole log when
+// it is shorter than offset because it was rotated in the meantime.
+func dpkgLogTailCommand(offset int64) string {
+	return fmt.Sprintf(`if [ ! -e %[1]s ]; then :; elif [ "$(wc -c < %[1]s)" -ge %[2]d ]; then tail -c +%[3]d %[1]s; else cat %[1]s; fi`,
+		dpkgLog, offset, offset+1)
+}
+
+// captureDpkgLog writes the dpkg.log lines of the build to capture_dpkg_log
+// on the host.
+func (p *Provisioner) captureDpkgLog(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Writing the dpkg log of this build to %s", p.config.CaptureDpkgLog))
+	output, err := runRemoteOutput(ctx, comm, dpkgLogTailCommand(p.dpkgLogOffset))
+	if err != nil {
+		return err
+	}
+	if p.config.Explain {
+		return nil
+	}
+	return ioutil.WriteFile(p.config.CaptureDpkgLog, []byte(output), 0644)
+}
@@ -0,0 +1,86 @@
+package apt
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// mutatingCommands are the commands a dry run must not run.
+var mutatingCommands = []string{
+	"/usr/bin/dpkg --configure -a",
+	"/usr/bin/apt-get -f install -y",
+	"/usr/bin/apt-get purge",
+	"install -y --no-install-recommends deborphan",
+	"install -y --no-install-recommends gdebi-core",
+	"/usr/bin/gdebi",
+	"/usr/bin/apt-mark hold",
+	"/bin/systemctl",
+	"/usr/sbin/dkms",
+	"/sbin/shutdown",
+}
+
+func TestDryRunSkipsChanges(t *testing.T) {
+	deb := filepath.Join(t.TempDir(), "tool_1.0_amd64.deb")
+	if err := ioutil.WriteFile(deb, []byte("deb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provisioner{config: Config{
+		DryRun:            true,
+		FixBrokenAttempts: 3,
+		UseGdebi:          true,
+		Hold:              []string{"nginx"},
+		EnableServices:    []string{"nginx.service"},
+		MaskServices:      []string{"apt-daily.timer"},
+		DKMSKernelVersion: "6.1.0-18-amd64",
+	}}
+	comm := &fakeComm{output: func(command string) string {
+		switch {
+		case strings.Contains(command, "deborphan"):
+			return "libfoo1\n"
+		case strings.Contains(command, "dpkg-query"):
+			return "ii nginx 1.22.1-9\n"
+		case strings.Contains(command, "${db:Status-Abbrev}' dkms"):
+			return "ii "
+		}
+		return ""
+	}}
+	ctx, ui := context.Background(), packer.TestUi(t)
+
+	steps := map[string]func() error{
+		"fix_broken":     func() error { return p.fixBroken(ctx, ui, comm) },
+		"remove_orphans": func() error { return p.removeRemoteOrphans(ctx, ui, comm) },
+		"deb_files":      func() error { return p.installRemoteDebs(ctx, ui, comm, []string{deb}) },
+		"hold":           func() error { return p.holdRemotePackages(ctx, ui, comm) },
+		"services":       func() error { return p.manageRemoteServices(ctx, ui, comm) },
+		"dkms":           func() error { return p.buildRemoteDKMSModules(ctx, ui, comm) },
+		"reboot":         func() error { return p.rebootIfRequired(ctx, ui, comm) },
+	}
+	for name, step := range steps {
+		if err := step(); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	for _, command := range comm.commands {
+		for _, mutating := range mutatingCommands {
+			if strings.Contains(command, mutating) {
+				t.Errorf("dry run ran %q", command)
+			}
+		}
+	}
+	all := strings.Join(comm.commands, "\n")
+	for _, want := range []string{
+		"/usr/bin/apt-get -s -f install -y",
+		"/usr/bin/apt-get install -s -y --no-install-recommends /tmp/packer-apt-debs/tool_1.0_amd64.deb",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("dry run didn't simulate %q:\n%s", want, all)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package apt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+const redacted = "<sensitive>"
+
+// redactor replaces secrets in the strings of a dumped configuration: the
+// GitHub token, the values of sensitive variables, the answers to preseed
+// password questions and the passwords of URLs.
+type redactor struct {
+	secrets []string
+}
+
+func newRedactor(c *Config) *redactor {
+	r := &redactor{}
+	if c.GitHubToken != "" {
+		r.secrets = append(r.secrets, c.GitHubToken)
+	}
+	for _, name := range c.PackerSensitiveVars {
+		if value := c.PackerUserVars[name]; value != "" {
+			r.secrets = append(r.secrets, value)
+		}
+	}
+	for _, line := range c.preseedSelections {
+		if typ, value, _ := parseSelection(line); typ == "password" && value != "" {
+			r.secrets = append(r.secrets, value)
+		}
+	}
+	// Replace longer secrets first, so that a secret containing another one
+	// is still redacted as a whole.
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+func (r *redactor) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	for _, field := range strings.Fields(s) {
+		if u, err := url.Parse(field); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				s = strings.Replace(s, u.User.String()+"@", url.User(u.User.Username()).String()+":"+redacted+"@", 1)
+			}
+		}
+	}
+	return s
+}
+
+// value converts a configuration value to its JSON form, keyed by the
+// mapstructure names a template uses.
+func (r *redactor) value(v reflect.Value) interface{} {
+	switch t := v.Interface().(type) {
+	case time.Duration:
+		return t.String()
+	case config.Trilean:
+		return t.ToBoolPointer()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return r.redact(v.String())
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		r.fields(v, m)
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = r.value(v.Index(i))
+		}
+		return list
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[r.redact(fmt.Sprint(iter.Key().Interface()))] = r.value(iter.Value())
+		}
+		return m
+	}
+	return v.Interface()
+}
+
+func (r *redactor) fields(v reflect.Value, m map[string]interface{}) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")
+		if len(tag) > 1 && tag[1] == "squash" {
+			r.fields(v.Field(i), m)
+			continue
+		}
+		if tag[0] == "" {
+			continue
+		}
+		m[tag[0]] = r.value(v.Field(i))
+	}
+}
+
+// dumpResolvedConfig writes the configuration as it is used, with defaults
+// applied and secrets redacted, as JSON to dump_resolved_config. The cache
+// directory is the one resolved for the guest.
+func (p *Provisioner) dumpResolvedConfig() error {
+	r := newRedactor(&p.config)
+	m := make(map[string]interface{})
+	r.fields(reflect.ValueOf(p.config), m)
+	m["cache_dir"] = p.cacheDir
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.config.DumpResolvedConfig, buf.Bytes(), 0644)
+}
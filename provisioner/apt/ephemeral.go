@@ -0,0 +1,62 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const remoteArchivesDir = "/var/cache/apt/archives"
+
+// archivesDir returns the guest directory apt downloads packages to.
+func (p *Provisioner) archivesDir() string {
+	if p.ephemeralStateDir != "" {
+		return path.Join(p.ephemeralStateDir, "cache", "archives")
+	}
+	return remoteArchivesDir
+}
+
+// listsDir returns the guest directory apt keeps the package indexes in.
+func (p *Provisioner) listsDir() string {
+	if p.ephemeralStateDir != "" {
+		return path.Join(p.ephemeralStateDir, "lists")
+	}
+	return remoteListsDir
+}
+
+// renderEphemeralState renders the options that move apt's package indexes
+// and download cache to dir. The rest of Dir::State, such as the record of
+// automatically installed packages, has to stay in the image.
+func renderEphemeralState(dir string) string {
+	return fmt.Sprintf(`Dir::State::Lists "%[1]s/lists";
+Dir::Cache "%[1]s/cache";
+`, dir)
+}
+
+// setupEphemeralState creates a temporary directory for the package indexes
+// and download cache of the build, which is removed during cleanup. It is
+// readable by the _apt user, so that downloads stay sandboxed.
+func (p *Provisioner) setupEphemeralState(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	dir, err := runRemoteOutput(ctx, comm, "/bin/mktemp -d /tmp/packer-apt-state.XXXXXX")
+	if err != nil {
+		return err
+	}
+	p.ephemeralStateDir = strings.TrimSpace(dir)
+	if p.ephemeralStateDir == "" {
+		p.ephemeralStateDir = "/tmp/packer-apt-state"
+	}
+	ui.Say(fmt.Sprintf("Keeping APT package indexes and downloads of the build in %s", p.ephemeralStateDir))
+
+	cmd := &packer.RemoteCmd{Command: fmt.Sprintf("/bin/chmod 755 '%[1]s' && /bin/mkdir -p '%[2]s/partial' '%[3]s/partial'",
+		p.ephemeralStateDir, p.listsDir(), p.archivesDir())}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("failed to create %s: exit status %d", p.ephemeralStateDir, status)
+	}
+	return p.uploadAptConf(comm, "00packer-ephemeral-state", renderEphemeralState(p.ephemeralStateDir))
+}
@@ -0,0 +1,67 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// explainCommunicator stands in for the guest in explain mode. Instead of
+// running commands and transferring files, it prints what would be done and
+// reports success with no output, so that probes of the guest find nothing
+// to act on.
+type explainCommunicator struct {
+	ui packer.Ui
+}
+
+func (c *explainCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	msg := "Would run: " + cmd.Command
+	if cmd.Stdin != nil {
+		if script, err := ioutil.ReadAll(cmd.Stdin); err == nil && len(script) != 0 {
+			msg += " with input:\n" + strings.TrimRight(string(script), "\n")
+		}
+	}
+	c.ui.Say(msg)
+	cmd.SetExited(0)
+	return nil
+}
+
+func (c *explainCommunicator) Upload(dst string, r io.Reader, _ *os.FileInfo) error {
+	msg := "Would upload " + dst
+	if data, err := ioutil.ReadAll(r); err == nil && isText(data) {
+		msg += ":\n" + strings.TrimRight(string(data), "\n")
+	}
+	c.ui.Say(msg)
+	return nil
+}
+
+func (c *explainCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	c.ui.Say(fmt.Sprintf("Would upload directory %s to %s", src, dst))
+	return nil
+}
+
+func (c *explainCommunicator) Download(src string, w io.Writer) error {
+	c.ui.Say("Would download " + src)
+	return nil
+}
+
+func (c *explainCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	c.ui.Say(fmt.Sprintf("Would download directory %s to %s", src, dst))
+	return nil
+}
+
+// isText reports whether uploaded data is short, printable text such as a
+// sources list, rather than a binary key or package.
+func isText(data []byte) bool {
+	return len(data) != 0 && len(data) <= 4096 && utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// explainFacts stand in for the guest facts in explain mode.
+var explainFacts = &guestFacts{ID: "<id>", Codename: "<codename>", Arch: "<arch>"}
@@ -0,0 +1,79 @@
+package apt
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteReproducibleTar(t *testing.T) {
+	files := map[string]string{
+		"nginx_1.22.1-9_amd64.deb": "nginx",
+		"curl_7.88.1-10_amd64.deb": "curl",
+		"lock":                     "",
+	}
+
+	// The same packages written at different times, with different modes
+	// and in a different order, must give the same archive.
+	var archives [][]byte
+	for i, order := range [][]string{
+		{"nginx_1.22.1-9_amd64.deb", "curl_7.88.1-10_amd64.deb", "lock"},
+		{"lock", "curl_7.88.1-10_amd64.deb", "nginx_1.22.1-9_amd64.deb"},
+	} {
+		dir := t.TempDir()
+		for _, name := range order {
+			src := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(src, []byte(files[name]), 0600+os.FileMode(i)*044); err != nil {
+				t.Fatal(err)
+			}
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			if err := os.Chtimes(src, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Mkdir(filepath.Join(dir, "partial"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := filepath.Join(t.TempDir(), "cache.tar")
+		if err := writeReproducibleTar(dir, dst); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, err := ioutil.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, data)
+	}
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Fatal("archives of the same packages differ")
+	}
+
+	tr := tar.NewReader(bytes.NewReader(archives[0]))
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.ModTime.Equal(time.Unix(0, 0)) || hdr.Mode != 0644 || hdr.Uid != 0 || hdr.Uname != "" {
+			t.Errorf("%s: header not normalized: %+v", hdr.Name, hdr)
+		}
+		data, _ := ioutil.ReadAll(tr)
+		if string(data) != files[hdr.Name] {
+			t.Errorf("%s: content %q, want %q", hdr.Name, data, files[hdr.Name])
+		}
+		names = append(names, hdr.Name)
+	}
+	if want := []string{"curl_7.88.1-10_amd64.deb", "nginx_1.22.1-9_amd64.deb"}; len(names) != 2 || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("entries %q, want %q", names, want)
+	}
+}
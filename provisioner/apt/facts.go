@@ -0,0 +1,64 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// guestFacts describes the distribution and architecture of the guest.
+type guestFacts struct {
+	ID       string
+	Codename string
+	Arch     string
+}
+
+const guestFactsCommand = `/bin/sh -c '. /etc/os-release; ` +
+	`echo "${ID:-unknown}"; echo "${VERSION_CODENAME:-unknown}"; /usr/bin/dpkg --print-architecture'`
+
+// guestFacts detects the guest facts once and returns the cached result on
+// subsequent calls.
+func (p *Provisioner) guestFacts(ctx context.Context, comm packer.Communicator) (*guestFacts, error) {
+	if p.facts != nil {
+		return p.facts, nil
+	}
+	output, err := runRemoteOutput(ctx, comm, guestFactsCommand)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected guest facts: %q", output)
+	}
+	p.facts = &guestFacts{ID: fields[0], Codename: fields[1], Arch: fields[2]}
+	return p.facts, nil
+}
+
+func (f *guestFacts) namespace() string {
+	return fmt.Sprintf("%s-%s-%s", f.ID, f.Codename, f.Arch)
+}
+
+// resolveCacheDir picks the host cache directory used for this guest, which
+// is a per-target subdirectory of cache_dir when namespace_cache is set.
+func (p *Provisioner) resolveCacheDir(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	p.cacheDir = p.config.CacheDir
+	if !p.config.NamespaceCache {
+		return nil
+	}
+
+	facts, err := p.guestFacts(ctx, comm)
+	if err != nil {
+		return err
+	}
+	p.cacheDir = filepath.Join(p.config.CacheDir, facts.namespace())
+	ui.Say(fmt.Sprintf("Using APT cache %s", p.cacheDir))
+
+	if _, err := os.Stat(p.config.CacheDir); err == nil && !p.config.Explain {
+		return os.MkdirAll(p.cacheDir, 0755)
+	}
+	return nil
+}
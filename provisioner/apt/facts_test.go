@@ -0,0 +1,78 @@
+package apt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestResolveCacheDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace bool
+		explain   bool
+		output    string
+		want      string
+		err       bool
+		created   bool
+	}{
+		{name: "shared cache", output: "debian\nbookworm\namd64\n", want: ""},
+		{name: "debian", namespace: true, output: "debian\nbookworm\namd64\n", want: "debian-bookworm-amd64", created: true},
+		{name: "ubuntu arm64", namespace: true, output: "ubuntu\njammy\narm64\n", want: "ubuntu-jammy-arm64", created: true},
+		{name: "no codename", namespace: true, output: "debian\nunknown\ni386\n", want: "debian-unknown-i386", created: true},
+		{name: "explain creates nothing", namespace: true, explain: true, output: "debian\nbookworm\namd64\n", want: "debian-bookworm-amd64"},
+		{name: "unexpected facts", namespace: true, output: "debian\namd64\n", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			comm := &fakeComm{output: func(command string) string {
+				if command == guestFactsCommand {
+					return tt.output
+				}
+				return ""
+			}}
+			p := &Provisioner{config: Config{CacheDir: dir, NamespaceCache: tt.namespace, Explain: tt.explain}}
+
+			err := p.resolveCacheDir(context.Background(), packer.TestUi(t), comm)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := filepath.Join(dir, tt.want); p.cacheDir != want {
+				t.Errorf("cache dir %q, want %q", p.cacheDir, want)
+			}
+			if !tt.namespace && len(comm.commands) != 0 {
+				t.Errorf("guest facts detected without namespace_cache: %q", comm.commands)
+			}
+			if _, err := os.Stat(p.cacheDir); tt.want != "" && (err == nil) != tt.created {
+				t.Errorf("namespaced cache dir exists: %v, want %v", err == nil, tt.created)
+			}
+		})
+	}
+}
+
+func TestGuestFactsDetectedOnce(t *testing.T) {
+	comm := &fakeComm{output: func(string) string { return "debian\nbookworm\namd64\n" }}
+	p := &Provisioner{}
+	for i := 0; i < 2; i++ {
+		facts, err := p.guestFacts(context.Background(), comm)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if facts.namespace() != "debian-bookworm-amd64" {
+			t.Errorf("namespace %q", facts.namespace())
+		}
+	}
+	if len(comm.commands) != 1 {
+		t.Errorf("guest facts detected %d times", len(comm.commands))
+	}
+}
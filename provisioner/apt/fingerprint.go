@@ -0,0 +1,50 @@
+package apt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+var fingerprintRe = regexp.MustCompile(`^[0-9A-F]{40}$`)
+
+// normalizeFingerprint upper-cases a fingerprint and drops the spaces and 0x
+// prefix it is often written with.
+func normalizeFingerprint(fpr string) string {
+	fpr = strings.ToUpper(strings.Join(strings.Fields(fpr), ""))
+	return strings.TrimPrefix(fpr, "0X")
+}
+
+// keyFingerprints returns the primary key fingerprints of an armored or
+// binary OpenPGP key file.
+func keyFingerprints(data []byte) ([]string, error) {
+	read := openpgp.ReadKeyRing
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP")) {
+		read = openpgp.ReadArmoredKeyRing
+	}
+	entities, err := read(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var fprs []string
+	for _, entity := range entities {
+		fprs = append(fprs, fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint))
+	}
+	return fprs, nil
+}
+
+// verifyFingerprint checks that data holds exactly the key with the expected
+// fingerprint, so that a swapped or padded key file is rejected.
+func verifyFingerprint(data []byte, expected string) error {
+	fprs, err := keyFingerprints(data)
+	if err != nil {
+		return fmt.Errorf("failed to read key: %v", err)
+	}
+	if len(fprs) != 1 || fprs[0] != normalizeFingerprint(expected) {
+		return fmt.Errorf("key fingerprint mismatch: expected %s, got %s", normalizeFingerprint(expected), strings.Join(fprs, ", "))
+	}
+	return nil
+}
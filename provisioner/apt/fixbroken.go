@@ -0,0 +1,41 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// fixBroken repairs interrupted or broken package installations, running
+// dpkg --configure -a and apt-get -f install until apt-get check reports a
+// consistent system or fix_broken_attempts passes have been made. A dry run
+// only simulates apt-get -f install.
+func (p *Provisioner) fixBroken(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if p.config.DryRun {
+		ui.Say("Dry run, simulating the repair of broken packages")
+		return runRemoteCommand(ctx, ui, comm, p.aptCommand(noninteractive, "/usr/bin/apt-get -s -f install -y"))
+	}
+	for attempt := 1; attempt <= p.config.FixBrokenAttempts; attempt++ {
+		ui.Say(fmt.Sprintf("Repairing broken packages (attempt %d of %d)", attempt, p.config.FixBrokenAttempts))
+		for _, command := range []string{
+			"/usr/bin/dpkg --configure -a",
+			"/usr/bin/apt-get -f install -y",
+		} {
+			cmd := &packer.RemoteCmd{Command: p.aptCommand(noninteractive, command)}
+			if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+				return err
+			}
+		}
+
+		cmd := &packer.RemoteCmd{Command: p.aptCommand(nil, "/usr/bin/apt-get check")}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return err
+		}
+		if cmd.ExitStatus() == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("packages are still broken after %d fix_broken attempts, see apt-get check output above",
+		p.config.FixBrokenAttempts)
+}
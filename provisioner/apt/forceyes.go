@@ -0,0 +1,12 @@
+package apt
+
+// forceYesOptions returns the apt-get options that replace the deprecated
+// --force-yes. They let apt remove essential packages, change held packages
+// and downgrade without the "Yes, do as I say!" confirmation that -y
+// doesn't answer.
+func (p *Provisioner) forceYesOptions() string {
+	if !p.config.ForceYes {
+		return ""
+	}
+	return "--allow-remove-essential --allow-change-held-packages --allow-downgrades "
+}
@@ -0,0 +1,59 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// aptFrontend is a command line tool that installs, updates and upgrades
+// packages, with the subcommands of each upgrade mode.
+type aptFrontend struct {
+	tool    string
+	upgrade map[string]string
+}
+
+var frontends = map[string]aptFrontend{
+	"apt-get": {"/usr/bin/apt-get", upgradeCommands},
+	"apt":     {"/usr/bin/apt", map[string]string{"safe": "upgrade", "full": "full-upgrade"}},
+	"nala":    {"/usr/bin/nala", map[string]string{"safe": "upgrade --no-full", "full": "upgrade --full"}},
+}
+
+// frontendCommand returns the command line of a frontend subcommand.
+func (p *Provisioner) frontendCommand(subcommand string) string {
+	return frontends[p.config.Frontend].tool + " " + subcommand
+}
+
+// updateSubcommand returns the frontend subcommand that refreshes the package
+// index.
+func (p *Provisioner) updateSubcommand() string {
+	if p.config.AllowReleaseinfoChange {
+		return "update --allow-releaseinfo-change"
+	}
+	return "update"
+}
+
+func (p *Provisioner) upgradeCommand() string {
+	return p.frontendCommand(frontends[p.config.Frontend].upgrade[p.config.Upgrade])
+}
+
+// ensureRemoteFrontend installs nala with apt-get unless it is present.
+func (p *Provisioner) ensureRemoteFrontend(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if p.config.Frontend != "nala" {
+		return nil
+	}
+	cmd := &packer.RemoteCmd{
+		Command: fmt.Sprintf("test -x %s || %s",
+			frontends["nala"].tool,
+			p.aptCommand(noninteractive, "/usr/bin/apt-get install -y --no-install-recommends nala"),
+		),
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("failed to install nala: exit status %d", cmd.ExitStatus())
+	}
+	return nil
+}
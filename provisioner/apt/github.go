@@ -0,0 +1,137 @@
+package apt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const githubAPI = "https://api.github.com"
+
+var githubRepoRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+type githubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+// releaseURL returns the API URL of the release, which is the latest release
+// unless a tag is given.
+func (d GitHubReleaseDeb) releaseURL(api string) string {
+	if d.Tag == "" || d.Tag == "latest" {
+		return fmt.Sprintf("%s/repos/%s/releases/latest", api, d.Repo)
+	}
+	return fmt.Sprintf("%s/repos/%s/releases/tags/%s", api, d.Repo, url.PathEscape(d.Tag))
+}
+
+// matchAsset returns the one .deb asset of the release matching the asset
+// pattern.
+func (d GitHubReleaseDeb) matchAsset(release *githubRelease) (githubAsset, error) {
+	var matches []githubAsset
+	var names []string
+	for _, asset := range release.Assets {
+		if ok, _ := path.Match(d.AssetPattern, asset.Name); ok && filepath.Ext(asset.Name) == ".deb" {
+			matches = append(matches, asset)
+			names = append(names, asset.Name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return githubAsset{}, fmt.Errorf("%s release %s has no .deb asset matching %q", d.Repo, release.TagName, d.AssetPattern)
+	case 1:
+		return matches[0], nil
+	}
+	return githubAsset{}, fmt.Errorf("%s release %s has several .deb assets matching %q: %s", d.Repo, release.TagName, d.AssetPattern, strings.Join(names, " "))
+}
+
+func (p *Provisioner) githubRequest(ctx context.Context, u string, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if p.config.GitHubToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.GitHubToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: unexpected status %s", u, resp.Status)
+	}
+	return resp, nil
+}
+
+// downloadGitHubDeb finds the release asset and downloads it to dir.
+func (p *Provisioner) downloadGitHubDeb(ctx context.Context, d GitHubReleaseDeb, dir string) (string, error) {
+	resp, err := p.githubRequest(ctx, d.releaseURL(githubAPI), "application/vnd.github+json")
+	if err != nil {
+		return "", err
+	}
+	var release githubRelease
+	err = json.NewDecoder(resp.Body).Decode(&release)
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid release: %v", d.Repo, err)
+	}
+
+	asset, err := d.matchAsset(&release)
+	if err != nil {
+		return "", err
+	}
+	resp, err = p.githubRequest(ctx, asset.URL, "application/octet-stream")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	dst := filepath.Join(dir, filepath.Base(asset.Name))
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return "", err
+	}
+	return dst, f.Close()
+}
+
+// installGitHubReleaseDebs downloads the .deb assets of GitHub releases on
+// the host and installs them like deb_files.
+func (p *Provisioner) installGitHubReleaseDebs(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	dir, err := ioutil.TempDir(os.TempDir(), "packer-apt-github-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var debs []string
+	for _, d := range p.config.GitHubReleaseDebs {
+		ui.Say(fmt.Sprintf("Downloading %s from the %s release of %s", d.AssetPattern, d.Tag, d.Repo))
+		deb, err := p.downloadGitHubDeb(ctx, d, dir)
+		if err != nil {
+			return err
+		}
+		debs = append(debs, deb)
+	}
+	return p.installRemoteDebs(ctx, ui, comm, debs)
+}
@@ -0,0 +1,42 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// grubDebconfSelection renders the debconf-set-selections(1) line that
+// answers the grub-pc question about the disks to install GRUB to.
+func grubDebconfSelection(devices []string) string {
+	return fmt.Sprintf("grub-pc grub-pc/install_devices multiselect %s\n", strings.Join(devices, ", "))
+}
+
+// preseedGrubInstallDevices sets the grub-pc install devices in debconf so
+// that upgrades of grub-pc don't stop to ask for them. Targets without
+// grub-pc installed are left alone.
+func (p *Provisioner) preseedGrubInstallDevices(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	status, err := runRemoteOutput(ctx, comm, "/usr/bin/dpkg-query -W -f '${db:Status-Abbrev}' grub-pc 2>/dev/null || true")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(status, "ii") && !p.config.Explain {
+		ui.Say("grub-pc is not installed, not preseeding its install devices")
+		return nil
+	}
+
+	ui.Say(fmt.Sprintf("Preseeding grub-pc install devices: %s", strings.Join(p.config.GrubInstallDevices, ", ")))
+	cmd := &packer.RemoteCmd{
+		Command: "/usr/bin/debconf-set-selections",
+		Stdin:   strings.NewReader(grubDebconfSelection(p.config.GrubInstallDevices)),
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("debconf-set-selections failed with exit status %d", status)
+	}
+	return nil
+}
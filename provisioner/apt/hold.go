@@ -0,0 +1,51 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// holdRemotePackages marks the hold packages with apt-mark hold, so that
+// later upgrades in the image leave them alone. Packages that aren't
+// installed are reported and skipped.
+func (p *Provisioner) holdRemotePackages(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	output, err := runRemoteOutput(ctx, comm, fmt.Sprintf(
+		"/usr/bin/dpkg-query -W -f '${db:Status-Abbrev} ${binary:Package} ${Version}\\n' %s 2>/dev/null || true",
+		strings.Join(p.config.Hold, " "),
+	))
+	if err != nil {
+		return err
+	}
+	installed := parseInstalledVersions(output)
+
+	var hold, missing []string
+	for _, pkg := range p.config.Hold {
+		if _, ok := installed[pkg]; ok || p.config.Explain {
+			hold = append(hold, pkg)
+		} else {
+			missing = append(missing, pkg)
+		}
+	}
+	if len(missing) != 0 {
+		ui.Error(fmt.Sprintf("Not holding packages that aren't installed: %s", strings.Join(missing, " ")))
+	}
+	if len(hold) == 0 {
+		return nil
+	}
+	if p.config.DryRun {
+		ui.Say(fmt.Sprintf("Dry run, skipping apt-mark hold %s", strings.Join(hold, " ")))
+		return nil
+	}
+
+	cmd := &packer.RemoteCmd{Command: p.aptCommand(nil, "/usr/bin/apt-mark hold "+strings.Join(hold, " "))}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("apt-mark hold %s failed with exit status %d", strings.Join(hold, " "), status)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// runRemoteHooks runs user commands with the environment, umask and command
+// prefix of the apt invocations, through sudo when use_sudo is set. The
+// first command that fails stops the build.
+func (p *Provisioner) runRemoteHooks(ctx context.Context, ui packer.Ui, comm packer.Communicator, name string, commands []string) error {
+	for _, command := range commands {
+		ui.Say(fmt.Sprintf("Running %s: %s", name, command))
+		cmd := &packer.RemoteCmd{Command: p.aptCommand(noninteractive, "/bin/sh -c "+shellQuote(command))}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return err
+		}
+		if status := cmd.ExitStatus(); status != 0 {
+			return fmt.Errorf("%s: %q exited with status %d", name, command, status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+//go:build failinject
+// +build failinject
+
+package apt
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// failCountEnv sets how many times each of fail_phases fails before it is
+// allowed to succeed. It defaults to once.
+const failCountEnv = "PACKER_APT_FAIL_COUNT"
+
+// injectedFailure is the error of a failure injected by fail_phases.
+type injectedFailure struct {
+	phase    string
+	n, count int
+}
+
+func (e *injectedFailure) Error() string {
+	return fmt.Sprintf("injected failure %d of %d in %s", e.n, e.count, e.phase)
+}
+
+// validateFailPhases checks that fail_phases only names phases that can be
+// failed.
+func (c *Config) validateFailPhases(errs *packer.MultiError) *packer.MultiError {
+	for _, phase := range c.FailPhases {
+		switch phase {
+		case "key_download", "update", "install":
+		default:
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("fail_phases must name key_download, update or install: %q", phase))
+		}
+	}
+	return errs
+}
+
+// injectFailure fails the phase while it hasn't failed the configured number
+// of times yet. It lets tests exercise retries and error paths, is only
+// built with the failinject tag and does nothing unless fail_phases names
+// the phase.
+func (p *Provisioner) injectFailure(phase string) error {
+	if !containsString(p.config.FailPhases, phase) {
+		return nil
+	}
+	count := 1
+	if n, err := strconv.Atoi(os.Getenv(failCountEnv)); err == nil {
+		count = n
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.injectedFailures == nil {
+		p.injectedFailures = make(map[string]int)
+	}
+	if p.injectedFailures[phase] >= count {
+		return nil
+	}
+	p.injectedFailures[phase]++
+	return &injectedFailure{phase: phase, n: p.injectedFailures[phase], count: count}
+}
@@ -0,0 +1,143 @@
+//go:build failinject
+// +build failinject
+
+package apt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// setFailCount sets PACKER_APT_FAIL_COUNT for the rest of the test.
+func setFailCount(t *testing.T, count string) {
+	t.Helper()
+	if err := os.Setenv(failCountEnv, count); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Unsetenv(failCountEnv) })
+}
+
+func TestInjectedUpdateFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    string
+		updates  int
+		retrying []string
+		err      string
+	}{
+		{
+			name:     "fails once by default",
+			updates:  1,
+			retrying: []string{"apt-get update failed, retrying in 1ms (attempt 2 of 3)"},
+		},
+		{
+			name:    "retried until it succeeds",
+			count:   "2",
+			updates: 1,
+			retrying: []string{
+				"apt-get update failed, retrying in 1ms (attempt 2 of 3)",
+				"apt-get update failed, retrying in 1ms (attempt 3 of 3)",
+			},
+		},
+		{
+			name:  "more failures than tries",
+			count: "3",
+			retrying: []string{
+				"apt-get update failed, retrying in 1ms (attempt 2 of 3)",
+				"apt-get update failed, retrying in 1ms (attempt 3 of 3)",
+			},
+			err: "injected failure 3 of 3 in update",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFailCount(t, tt.count)
+			comm := &fakeComm{}
+			ui := &recordingUi{Ui: packer.TestUi(t)}
+			p := &Provisioner{config: Config{FailPhases: []string{"update"}, RetryTries: 3, RetryDelay: time.Millisecond}}
+
+			err := p.updateRemotePackageIndex(context.Background(), ui, comm)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+			if len(comm.commands) != tt.updates {
+				t.Errorf("apt-get update run %d times, want %d", len(comm.commands), tt.updates)
+			}
+			var retrying []string
+			for _, msg := range ui.said {
+				if strings.Contains(msg, "retrying") {
+					retrying = append(retrying, msg)
+				}
+			}
+			if strings.Join(retrying, "\n") != strings.Join(tt.retrying, "\n") {
+				t.Errorf("retries reported:\n%s\nwant:\n%s", strings.Join(retrying, "\n"), strings.Join(tt.retrying, "\n"))
+			}
+		})
+	}
+}
+
+func TestInjectedKeyDownloadFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("key"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		retries int
+		err     string
+	}{
+		{name: "retried", retries: 1},
+		{name: "no retries", err: "injected failure 1 of 1 in key_download"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFailCount(t, "1")
+			p := &Provisioner{config: Config{
+				FailPhases:         []string{"key_download"},
+				KeyDownloadRetries: tt.retries,
+				KeyDownloadTimeout: time.Second,
+			}}
+
+			data, err := p.fetchKey(context.Background(), server.URL+"/key.gpg")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || string(data) != "key" {
+				t.Fatalf("got %q, %v", data, err)
+			}
+			if p.injectedFailures["key_download"] != 1 {
+				t.Errorf("%d injected failures, want 1", p.injectedFailures["key_download"])
+			}
+		})
+	}
+}
+
+func TestPrepareFailPhases(t *testing.T) {
+	for phases, want := range map[string]string{
+		"update":  "",
+		"install": "",
+		"upgrade": `fail_phases must name key_download, update or install: "upgrade"`,
+	} {
+		_, err := prepare(t, map[string]interface{}{"fail_phases": []string{phases}})
+		if want == "" && err != "" {
+			t.Errorf("%s: unexpected error: %s", phases, err)
+		}
+		if !strings.Contains(err, want) {
+			t.Errorf("%s: expected error containing %q, got %q", phases, want, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package apt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// remoteInstallList is the guest file install_from_file passes the packages
+// to install in.
+const remoteInstallList = "/tmp/packer-apt-install.list"
+
+// renderInstallList renders one package per line.
+func renderInstallList(packages []string) string {
+	return strings.Join(packages, "\n") + "\n"
+}
+
+// installFromFileCommand uploads the packages to install to the guest and
+// returns the command that installs them with a single apt-get run through
+// xargs, removing the list afterwards. Keeping the packages out of the
+// command line avoids length limits of the communicator.
+func (p *Provisioner) installFromFileCommand(comm packer.Communicator, options string, packages []string) (string, error) {
+	if err := comm.Upload(remoteInstallList, strings.NewReader(renderInstallList(packages)), nil); err != nil {
+		return "", err
+	}
+	install := p.aptCommand(noninteractive, fmt.Sprintf(
+		"/usr/bin/xargs -r -a '%s' %s -y %s",
+		remoteInstallList,
+		p.frontendCommand("install"),
+		strings.TrimSpace(options),
+	))
+	return fmt.Sprintf("%s; status=$?; rm -f '%s'; exit $status", install, remoteInstallList), nil
+}
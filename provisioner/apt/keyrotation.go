@@ -0,0 +1,56 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var badSigRe = regexp.MustCompile(`(?:EXPKEYSIG|BADSIG|REVKEYSIG) ([0-9A-Fa-f]{8,40})`)
+
+// parseSignatureErrors reports whether apt-get update failed to verify the
+// signature of a Release file, e.g. after a repository rotated its key, and
+// returns the IDs of the expired, revoked or mismatching keys it named.
+// NODATA errors name no key.
+func parseSignatureErrors(output string) (ids []string, failed bool) {
+	for _, match := range badSigRe.FindAllStringSubmatch(output, -1) {
+		ids = appendUnique(ids, strings.ToUpper(match[1]))
+	}
+	failed = len(ids) != 0 ||
+		strings.Contains(output, "NODATA") ||
+		strings.Contains(output, "The following signatures were invalid") ||
+		strings.Contains(output, "signatures couldn't be verified")
+	return ids, failed
+}
+
+// refreshRotatedKeys downloads the key URLs of keys again and receives the
+// keys named in signature errors from the keyservers, so that a rotated key
+// replaces the one apt-get update rejected.
+func (p *Provisioner) refreshRotatedKeys(ctx context.Context, ui packer.Ui, comm packer.Communicator, ids []string) error {
+	var urls []string
+	for _, key := range p.config.Keys {
+		if isKeyURL(key) {
+			urls = append(urls, key)
+		}
+	}
+	if len(urls) == 0 && len(ids) == 0 {
+		return errors.New("apt-get update failed to verify release signatures and there are no key URLs or key IDs to refresh")
+	}
+
+	ui.Say("apt-get update failed to verify release signatures, refreshing APT keys")
+	for _, key := range urls {
+		if err := p.uploadKeyURL(ctx, ui, comm, key); err != nil {
+			return err
+		}
+	}
+	if len(ids) != 0 {
+		if err := p.recvRemoteKeys(ctx, ui, comm, ids); err != nil {
+			return fmt.Errorf("failed to refresh rotated keys: %v", err)
+		}
+	}
+	return nil
+}
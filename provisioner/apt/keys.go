@@ -0,0 +1,187 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+)
+
+const (
+	trustedKeysDir = "/etc/apt/trusted.gpg.d"
+	keyringsDir    = "/etc/apt/keyrings"
+)
+
+// isKeyURL reports whether a keys entry should be fetched over HTTP rather
+// than read from the host filesystem.
+func isKeyURL(key string) bool {
+	u, err := url.Parse(key)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// keyFileName returns the file name a keys entry is installed under: the
+// basename of the file or of the URL path.
+func keyFileName(key string) string {
+	if isKeyURL(key) {
+		u, _ := url.Parse(key)
+		return path.Base(u.Path)
+	}
+	return filepath.Base(key)
+}
+
+// fetchKey downloads key, retrying with a linear backoff when the request
+// fails or the server doesn't answer with 200 OK.
+func (p *Provisioner) fetchKey(ctx context.Context, key string) ([]byte, error) {
+	client := &http.Client{Timeout: p.config.KeyDownloadTimeout}
+	backoff := &retry.Backoff{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second, Multiplier: 2}
+
+	var data []byte
+	var lastErr error
+	err := retry.Config{
+		Tries:      p.config.KeyDownloadRetries + 1,
+		RetryDelay: backoff.Linear,
+	}.Run(ctx, func(ctx context.Context) error {
+		if lastErr = p.injectFailure("key_download"); lastErr != nil {
+			return lastErr
+		}
+		data, lastErr = getKey(ctx, client, key)
+		return lastErr
+	})
+	if err != nil {
+		if lastErr == nil {
+			lastErr = err
+		}
+		return nil, fmt.Errorf("failed to download key %s: %v", key, lastErr)
+	}
+	return data, nil
+}
+
+func getKey(ctx context.Context, client *http.Client, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (p *Provisioner) uploadKeyURL(ctx context.Context, ui packer.Ui, comm packer.Communicator, key string) error {
+	ui.Say(fmt.Sprintf("Downloading APT key %s", key))
+	data, err := p.fetchKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	if fpr, ok := p.config.KeyFingerprints[key]; ok {
+		if err := verifyFingerprint(data, fpr); err != nil {
+			ui.Error(fmt.Sprintf("Refusing to trust APT key %s", key))
+			return err
+		}
+	}
+
+	if err := p.installKey(ctx, ui, comm, keyFileName(key), data); err != nil {
+		ui.Error(fmt.Sprintf("Failed to upload APT key %s", key))
+		return err
+	}
+	return nil
+}
+
+func isArmoredKey(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"))
+}
+
+// installKey uploads a key file to each of its destinations. trusted.gpg.d
+// only takes binary keyrings, so an ASCII-armored key is dearmored with gpg
+// on the guest and installed as name.gpg instead of name.asc.
+func (p *Provisioner) installKey(ctx context.Context, ui packer.Ui, comm packer.Communicator, name string, data []byte) error {
+	armored := isArmoredKey(data)
+	if armored {
+		name = strings.TrimSuffix(name, ".asc") + ".gpg"
+	}
+
+	for _, dst := range p.keyDestinations(name) {
+		src := dst
+		if armored {
+			src = path.Join("/tmp", "packer-apt-"+name+".asc")
+		}
+		if err := comm.Upload(src, bytes.NewReader(data), nil); err != nil {
+			return err
+		}
+		if armored {
+			cmd := &packer.RemoteCmd{Command: fmt.Sprintf("/usr/bin/gpg --dearmor --yes -o '%s' '%s'; status=$?; rm -f '%s'; exit $status", dst, src, src)}
+			if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+				return err
+			}
+			if cmd.ExitStatus() != 0 {
+				return fmt.Errorf("gpg --dearmor exited with status %d, is gpg installed?", cmd.ExitStatus())
+			}
+		}
+		if err := p.chmodKey(ctx, ui, comm, dst); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.keyFiles = append(p.keyFiles, dst)
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// keyDestinations returns the guest paths a key file is installed to:
+// trusted.gpg.d, and with dual_key_install also the keyrings directory for
+// sources that reference it with signed-by.
+func (p *Provisioner) keyDestinations(name string) []string {
+	dsts := []string{path.Join(trustedKeysDir, name)}
+	if p.config.DualKeyInstall {
+		dsts = append(dsts, path.Join(keyringsDir, name))
+	}
+	return dsts
+}
+
+func (p *Provisioner) chmodKey(ctx context.Context, ui packer.Ui, comm packer.Communicator, dst string) error {
+	return runRemoteCommand(ctx, ui, comm, fmt.Sprintf("/bin/chmod %s '%s'", p.config.KeyFileMode, dst))
+}
+
+// migrateLegacyKeysScript exports every primary key of the legacy apt-key
+// keyring into its own file under trusted.gpg.d and removes the keyring.
+const migrateLegacyKeysScript = `set -e
+[ -s /etc/apt/trusted.gpg ] || exit 0
+export GNUPGHOME=$(mktemp -d)
+trap 'rm -rf "$GNUPGHOME"' EXIT
+keyring="--no-default-keyring --keyring /etc/apt/trusted.gpg"
+for fpr in $(gpg $keyring --with-colons --fingerprint | awk -F: '$1 == "pub" { pub = 1 } $1 == "fpr" && pub { print $10; pub = 0 }'); do
+	echo "Migrating legacy APT key $fpr"
+	gpg $keyring --export "$fpr" > "/etc/apt/trusted.gpg.d/legacy-$fpr.gpg"
+	chmod %s "/etc/apt/trusted.gpg.d/legacy-$fpr.gpg"
+done
+rm -f /etc/apt/trusted.gpg /etc/apt/trusted.gpg~`
+
+func (p *Provisioner) migrateRemoteLegacyKeys(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	script := fmt.Sprintf(migrateLegacyKeysScript, p.config.KeyFileMode)
+	cmd := &packer.RemoteCmd{
+		Command: "/bin/sh",
+		Stdin:   strings.NewReader(script),
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("legacy key migration exited with status %d", cmd.ExitStatus())
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestInstallKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		fail  string
+		dst   string
+		cmds  []string
+		error bool
+	}{
+		{
+			name: "binary key",
+			file: "example.gpg",
+			data: "\x99\x01\x0d",
+			dst:  "/etc/apt/trusted.gpg.d/example.gpg",
+			cmds: []string{"/bin/chmod 0644 '/etc/apt/trusted.gpg.d/example.gpg'"},
+		},
+		{
+			name: "armored key",
+			file: "example.asc",
+			data: "-----BEGIN PGP PUBLIC KEY BLOCK-----\n",
+			dst:  "/tmp/packer-apt-example.gpg.asc",
+			cmds: []string{
+				"/usr/bin/gpg --dearmor --yes -o '/etc/apt/trusted.gpg.d/example.gpg' '/tmp/packer-apt-example.gpg.asc'; status=$?; rm -f '/tmp/packer-apt-example.gpg.asc'; exit $status",
+				"/bin/chmod 0644 '/etc/apt/trusted.gpg.d/example.gpg'",
+			},
+		},
+		{
+			name:  "chmod fails",
+			file:  "example.gpg",
+			data:  "\x99\x01\x0d",
+			fail:  "/bin/chmod",
+			error: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm := &fakeComm{status: failing(tt.fail)}
+			p := &Provisioner{config: Config{KeyFileMode: "0644"}}
+
+			err := p.installKey(context.Background(), packer.TestUi(t), comm, tt.file, []byte(tt.data))
+			if tt.error {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if len(p.keyFiles) != 0 {
+					t.Errorf("key recorded as installed: %v", p.keyFiles)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok := comm.uploads[tt.dst]; !ok {
+				t.Errorf("nothing uploaded to %s: %v", tt.dst, comm.uploads)
+			}
+			if strings.Join(comm.commands, "\n") != strings.Join(tt.cmds, "\n") {
+				t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(comm.commands, "\n"), strings.Join(tt.cmds, "\n"))
+			}
+		})
+	}
+}
+
+// openFiles counts the file descriptors open in the test process.
+func openFiles(t *testing.T) int {
+	t.Helper()
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("can't count open files: %v", err)
+	}
+	return len(fds)
+}
+
+func TestUploadHostPackageTrustClosesKeys(t *testing.T) {
+	dir := t.TempDir()
+	var keys []string
+	for i := 0; i < 64; i++ {
+		key := filepath.Join(dir, fmt.Sprintf("key%d.gpg", i))
+		if err := ioutil.WriteFile(key, []byte("\x99\x01\x0d"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	p, errs := prepare(t, map[string]interface{}{"keys": keys})
+	if errs != "" {
+		t.Fatal(errs)
+	}
+	comm := &fakeComm{}
+
+	before := openFiles(t)
+	if err := p.uploadHostPackageTrust(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if after := openFiles(t); after > before {
+		t.Errorf("%d files left open after uploading %d keys", after-before, len(keys))
+	}
+	if len(p.keyFiles) != len(keys) {
+		t.Errorf("%d keys installed, want %d", len(p.keyFiles), len(keys))
+	}
+}
@@ -0,0 +1,80 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+)
+
+var noPubkeyRe = regexp.MustCompile(`NO_PUBKEY ([0-9A-Fa-f]{8,40})`)
+
+// parseMissingKeys returns the key IDs apt-get update reported as NO_PUBKEY.
+func parseMissingKeys(output string) []string {
+	var ids []string
+	for _, match := range noPubkeyRe.FindAllStringSubmatch(output, -1) {
+		ids = appendUnique(ids, strings.ToUpper(match[1]))
+	}
+	return ids
+}
+
+// recvKeysScript receives keys from a keyserver into a throwaway GnuPG home
+// and exports each of them as its own keyring under trusted.gpg.d.
+const recvKeysScript = `set -e
+export GNUPGHOME=$(mktemp -d)
+trap 'rm -rf "$GNUPGHOME"' EXIT
+timeout %[3]d gpg --batch --keyserver '%[2]s' --recv-keys %[1]s
+for id in %[1]s; do
+	gpg --batch --export "$id" > "/etc/apt/trusted.gpg.d/packer-$id.gpg"
+	chmod %[4]s "/etc/apt/trusted.gpg.d/packer-$id.gpg"
+done`
+
+// recvRemoteKeys receives keys from the keyservers in order until one of them
+// has all keys. Each round over the keyservers is retried with a linear
+// backoff, and the errors of every attempt are reported once all failed.
+func (p *Provisioner) recvRemoteKeys(ctx context.Context, ui packer.Ui, comm packer.Communicator, ids []string) error {
+	backoff := &retry.Backoff{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second, Multiplier: 2}
+
+	var failures []string
+	err := retry.Config{
+		Tries:      p.config.KeyserverRetries + 1,
+		RetryDelay: backoff.Linear,
+	}.Run(ctx, func(ctx context.Context) error {
+		for _, keyserver := range p.config.Keyservers {
+			err := p.recvRemoteKeysFrom(ctx, ui, comm, keyserver, ids)
+			if err == nil {
+				return nil
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", keyserver, err))
+		}
+		return errors.New("no keyserver had the keys")
+	})
+	if err != nil {
+		if len(failures) == 0 {
+			return err
+		}
+		return fmt.Errorf("failed to fetch keys %s: %s", strings.Join(ids, " "), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (p *Provisioner) recvRemoteKeysFrom(ctx context.Context, ui packer.Ui, comm packer.Communicator, keyserver string, ids []string) error {
+	ui.Say(fmt.Sprintf("Fetching missing APT keys from %s: %s", keyserver, strings.Join(ids, " ")))
+	cmd := &packer.RemoteCmd{
+		Command: "/bin/sh",
+		Stdin: strings.NewReader(fmt.Sprintf(recvKeysScript,
+			strings.Join(ids, " "), keyserver, int(p.config.KeyserverTimeout/time.Second), p.config.KeyFileMode)),
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("exit status %d", status)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// licenseScript prints the package, version, copyright format and licenses
+// of each installed package, separated by tabs. The format is dep5 for a
+// machine-readable copyright file, whose License fields are joined with
+// semicolons, text for a free-form one and missing when there is none.
+const licenseScript = `tab=$(printf '\t')
+dpkg-query -W -f '${db:Status-Abbrev}\t${binary:Package}\t${Package}\t${Version}\n' |
+while IFS="$tab" read -r status pkg name version; do
+  case "$status" in ii*) ;; *) continue ;; esac
+  f=/usr/share/doc/$name/copyright
+  format=missing licenses=
+  if [ -r "$f" ]; then
+    format=text
+    if head -n 1 "$f" | grep -q '^Format:'; then
+      format=dep5
+      licenses=$(sed -n 's/^License: *\(.*[^ ]\) *$/\1/p' "$f" | sort -u | tr '\n' ';')
+    fi
+  fi
+  printf '%s\t%s\t%s\t%s\n' "$pkg" "$version" "$format" "${licenses%;}"
+done`
+
+// packageLicense is one entry of the license report.
+type packageLicense struct {
+	Package         string   `json:"package"`
+	Version         string   `json:"version"`
+	CopyrightFormat string   `json:"copyright_format"`
+	Licenses        []string `json:"licenses"`
+}
+
+// parseLicenses reads the output of licenseScript.
+func parseLicenses(output string) []packageLicense {
+	var report []packageLicense
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		entry := packageLicense{Package: fields[0], Version: fields[1], CopyrightFormat: fields[2], Licenses: []string{}}
+		if fields[3] != "" {
+			entry.Licenses = strings.Split(fields[3], ";")
+		}
+		report = append(report, entry)
+	}
+	return report
+}
+
+// renderLicenseReport renders the report as CSV for a .csv file name and as
+// JSON otherwise.
+func renderLicenseReport(name string, report []packageLicense) ([]byte, error) {
+	var buf bytes.Buffer
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		w := csv.NewWriter(&buf)
+		records := [][]string{{"package", "version", "copyright_format", "licenses"}}
+		for _, entry := range report {
+			records = append(records, []string{entry.Package, entry.Version, entry.CopyrightFormat, strings.Join(entry.Licenses, ";")})
+		}
+		if err := w.WriteAll(records); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	if report == nil {
+		report = []packageLicense{}
+	}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeLicenseReport gathers the licenses of all installed packages from
+// their copyright files and writes them to license_report on the host.
+func (p *Provisioner) writeLicenseReport(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Writing the licenses of installed packages to %s", p.config.LicenseReport))
+	output, err := runRemoteOutput(ctx, comm, "/bin/sh -c "+shellQuote(licenseScript))
+	if err != nil {
+		return err
+	}
+	if p.config.Explain {
+		return nil
+	}
+
+	report := parseLicenses(output)
+	var unknown int
+	for _, entry := range report {
+		if len(entry.Licenses) == 0 {
+			unknown++
+		}
+	}
+	if unknown != 0 {
+		ui.Say(fmt.Sprintf("%d of %d packages have no machine-readable license", unknown, len(report)))
+	}
+
+	data, err := renderLicenseReport(p.config.LicenseReport, report)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.config.LicenseReport, data, 0644)
+}
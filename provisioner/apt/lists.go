@@ -0,0 +1,26 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const remoteListsDir = "/var/lib/apt/lists"
+
+// listsExclude keeps apt's lock and in-progress downloads out of the lists
+// cache in both directions.
+var listsExclude = []string{"lock", "partial"}
+
+func (p *Provisioner) uploadHostListsCache(ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Uploading APT lists cache from %s", p.config.ListsCacheDir))
+	src := p.config.ListsCacheDir + string(filepath.Separator)
+	return p.uploadDir(ui, comm, p.listsDir(), src, listsExclude)
+}
+
+func (p *Provisioner) updateListsCache(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Updating APT lists cache in %s", p.config.ListsCacheDir))
+	return p.downloadDir(ctx, ui, comm, p.listsDir()+"/", p.config.ListsCacheDir, listsExclude)
+}
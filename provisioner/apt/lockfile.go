@@ -0,0 +1,136 @@
+package apt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// packageName returns the package of a pkg, pkg=version or pkg/suite entry.
+func packageName(spec string) string {
+	if i := strings.IndexAny(spec, "=/"); i >= 0 {
+		return spec[:i]
+	}
+	return spec
+}
+
+// parseLockfile reads a lockfile with one pkg=version line per package,
+// ignoring blank lines and # comments.
+func parseLockfile(r io.Reader) (map[string]string, error) {
+	versions := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !packageSpecRe.MatchString(line) {
+			return nil, fmt.Errorf("line %d: invalid lockfile entry %q", n, scanner.Text())
+		}
+		versions[parts[0]] = parts[1]
+	}
+	return versions, scanner.Err()
+}
+
+func readLockfile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	versions, err := parseLockfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return versions, nil
+}
+
+// pinPackages pins every package that has a version in the lockfile. A
+// package already pinned to another version is an error.
+func pinPackages(packages []string, versions map[string]string) ([]string, error) {
+	pinned := make([]string, 0, len(packages))
+	for _, spec := range packages {
+		name := packageName(spec)
+		version, ok := versions[name]
+		if !ok {
+			pinned = append(pinned, spec)
+			continue
+		}
+		if spec != name && spec != name+"="+version {
+			return nil, fmt.Errorf("%s conflicts with locked version %s", spec, version)
+		}
+		pinned = append(pinned, name+"="+version)
+	}
+	return pinned, nil
+}
+
+// parseInstalledVersions reads dpkg-query output of status, package and
+// version triples, keeping the packages that are fully installed. Packages
+// are keyed both with and without their architecture qualifier.
+func parseInstalledVersions(output string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "ii" {
+			continue
+		}
+		versions[fields[1]] = fields[2]
+		versions[strings.SplitN(fields[1], ":", 2)[0]] = fields[2]
+	}
+	return versions
+}
+
+// renderLockfile writes the installed version of each package, sorted by
+// name so that the same versions always produce the same lockfile.
+func renderLockfile(packages []string, installed map[string]string) string {
+	var lines []string
+	for _, spec := range packages {
+		name := packageName(spec)
+		if version, ok := installed[name]; ok {
+			lines = append(lines, name+"="+version+"\n")
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+// writeLockfile records the installed versions of the requested packages
+// to the lockfile on the host.
+func (p *Provisioner) writeLockfile(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var names []string
+	for _, spec := range p.config.Packages {
+		names = append(names, packageName(spec))
+	}
+	ui.Say(fmt.Sprintf("Writing installed package versions to %s", p.config.LockfileOut))
+
+	var installed map[string]string
+	if len(names) != 0 {
+		output, err := runRemoteOutput(ctx, comm, fmt.Sprintf(
+			"/usr/bin/dpkg-query -W -f '${db:Status-Abbrev} ${binary:Package} ${Version}\\n' %s 2>/dev/null || true",
+			strings.Join(names, " "),
+		))
+		if err != nil {
+			return err
+		}
+		installed = parseInstalledVersions(output)
+	}
+	if p.config.Explain {
+		return nil
+	}
+
+	return ioutil.WriteFile(p.config.LockfileOut, []byte(renderLockfile(p.config.Packages, installed)), 0644)
+}
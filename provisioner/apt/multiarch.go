@@ -0,0 +1,38 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// debianArchitectures are the release architectures of Debian and Ubuntu
+// that dpkg --add-architecture accepts as foreign architectures.
+var debianArchitectures = []string{
+	"amd64", "arm64", "armel", "armhf", "i386", "mips64el", "mipsel", "ppc64el", "riscv64", "s390x",
+}
+
+// refreshesIndex reports whether the configuration changes what apt-get
+// update fetches, so that the package index is refreshed before installing.
+// Pre-commands often change the sources, e.g. with add-apt-repository.
+func (c *Config) refreshesIndex() bool {
+	return len(c.sourceLines()) != 0 || len(c.Architectures) != 0 || len(c.PreCommands) != 0
+}
+
+// addRemoteArchitectures enables the foreign architectures on the guest. The
+// package indexes for them are fetched by the next apt-get update.
+func (p *Provisioner) addRemoteArchitectures(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Adding foreign architectures: %s", strings.Join(p.config.Architectures, " ")))
+	for _, arch := range p.config.Architectures {
+		cmd := &packer.RemoteCmd{Command: p.aptCommand(nil, "/usr/bin/dpkg --add-architecture "+arch)}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return err
+		}
+		if status := cmd.ExitStatus(); status != 0 {
+			return fmt.Errorf("dpkg --add-architecture %s exited with status %d", arch, status)
+		}
+	}
+	return nil
+}
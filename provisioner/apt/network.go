@@ -0,0 +1,89 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+)
+
+// releaseURLs returns the Release file URLs of the configured http(s)
+// sources, in the order they are listed.
+func releaseURLs(sources []string) []string {
+	var urls []string
+	for _, source := range sources {
+		s, ok := parseSourceLine(source)
+		if !ok || !(strings.HasPrefix(s.URI, "http://") || strings.HasPrefix(s.URI, "https://")) {
+			continue
+		}
+		base := strings.TrimSuffix(s.URI, "/") + "/"
+		if strings.HasSuffix(s.Suite, "/") {
+			// Flat repository, the suite is a path relative to the URI.
+			urls = append(urls, base+strings.TrimPrefix(s.Suite, "./")+"Release")
+		} else {
+			urls = append(urls, base+"dists/"+s.Suite+"/Release")
+		}
+	}
+	return urls
+}
+
+// reachabilityScript succeeds as soon as one of the URLs can be fetched by
+// apt's own download helper, so it needs neither curl nor wget. Each failed
+// URL is reported with the first error of the helper, which names the URL
+// and the reason, such as the HTTP status.
+func reachabilityScript(urls []string, options string) string {
+	return fmt.Sprintf(`tmp=$(mktemp -d)
+for url in '%s'; do
+	if err=$(/usr/lib/apt/apt-helper %sdownload-file "$url" "$tmp/Release" 2>&1 >/dev/null); then
+		rm -rf "$tmp"
+		exit 0
+	fi
+	echo "$err" | grep '^E:' | head -n 1 >&2
+done
+rm -rf "$tmp"
+exit 1`, strings.Join(urls, "' '"), options)
+}
+
+// mirrorCheckOptions returns the apt-helper options for mirror_check_timeout.
+func (c *Config) mirrorCheckOptions() string {
+	if c.MirrorCheckTimeout == 0 {
+		return ""
+	}
+	secs := int(math.Ceil(c.MirrorCheckTimeout.Seconds()))
+	return fmt.Sprintf("-o Acquire::http::Timeout=%[1]d -o Acquire::https::Timeout=%[1]d ", secs)
+}
+
+func (p *Provisioner) requireRemoteNetwork(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	urls := releaseURLs(p.config.sourceLines())
+	ui.Say("Checking that the target can reach an APT mirror...")
+	backoff := &retry.Backoff{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second, Multiplier: 2}
+
+	var lastErr error
+	err := retry.Config{
+		Tries:      p.config.MirrorCheckRetries + 1,
+		RetryDelay: backoff.Linear,
+	}.Run(ctx, func(ctx context.Context) error {
+		var stderr syncBuffer
+		cmd := &packer.RemoteCmd{
+			Command: "/bin/sh",
+			Stdin:   strings.NewReader(reachabilityScript(urls, p.config.mirrorCheckOptions())),
+			Stderr:  &stderr,
+		}
+		if lastErr = cmd.RunWithUi(ctx, comm, ui); lastErr != nil {
+			return lastErr
+		}
+		if cmd.ExitStatus() != 0 {
+			lastErr = fmt.Errorf("none of the configured mirrors is reachable from the target: %s",
+				strings.Join(strings.Split(strings.TrimSpace(stderr.String()), "\n"), "; "))
+		}
+		return lastErr
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// newerInstalledScript prints each requested package that is installed at a
+// newer version than requested, which is the pinned version or, for an
+// unpinned request, the candidate apt would install. It reads package and
+// requested version pairs from its arguments, with an empty version for
+// unpinned requests.
+const newerInstalledScript = `while [ $# -gt 0 ]; do
+  pkg=$1 want=$2; shift 2
+  have=$(dpkg-query -W -f '${db:Status-Abbrev} ${Version}' "$pkg" 2>/dev/null | sed -n 's/^ii *\(.*\)$/\1/p')
+  [ -n "$have" ] || continue
+  [ -n "$want" ] || want=$(apt-cache policy "$pkg" | sed -n 's/^ *Candidate: //p')
+  case $want in ''|'(none)') continue ;; esac
+  if dpkg --compare-versions "$have" gt "$want"; then echo "$pkg $have $want"; fi
+done
+`
+
+// skipNewerInstalled drops the packages that are already installed at a
+// newer version than requested, so that they are neither reinstalled nor
+// downgraded.
+func (p *Provisioner) skipNewerInstalled(ctx context.Context, ui packer.Ui, comm packer.Communicator, packages []string) ([]string, error) {
+	if len(packages) == 0 {
+		return packages, nil
+	}
+	var args []string
+	for _, spec := range packages {
+		name := packageName(spec)
+		version := ""
+		if strings.HasPrefix(spec, name+"=") {
+			version = spec[len(name)+1:]
+		}
+		args = append(args, shellQuote(name), shellQuote(version))
+	}
+
+	output, err := runRemoteOutput(ctx, comm, p.aptCommand(nil,
+		"/bin/sh -c "+shellQuote(newerInstalledScript)+" sh "+strings.Join(args, " ")))
+	if err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		ui.Say(fmt.Sprintf("Skipping %s: installed version %s is newer than %s", fields[0], fields[1], fields[2]))
+		skip[fields[0]] = true
+	}
+
+	var kept []string
+	for _, spec := range packages {
+		if !skip[packageName(spec)] {
+			kept = append(kept, spec)
+		}
+	}
+	return kept, nil
+}
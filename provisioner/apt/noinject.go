@@ -0,0 +1,26 @@
+//go:build !failinject
+// +build !failinject
+
+package apt
+
+import (
+	"errors"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Failure injection is only built with the failinject tag, see inject.go.
+// Release builds never fail a phase and reject fail_phases.
+
+type injectedFailure struct{}
+
+func (e *injectedFailure) Error() string { return "injected failure" }
+
+func (c *Config) validateFailPhases(errs *packer.MultiError) *packer.MultiError {
+	if len(c.FailPhases) != 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("fail_phases is only supported by plugins built with -tags failinject"))
+	}
+	return errs
+}
+
+func (p *Provisioner) injectFailure(phase string) error { return nil }
@@ -0,0 +1,29 @@
+//go:build !failinject
+// +build !failinject
+
+package apt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestFailPhasesNeedFailinjectBuild(t *testing.T) {
+	_, err := prepare(t, map[string]interface{}{"fail_phases": []string{"update"}})
+	if !strings.Contains(err, "fail_phases is only supported by plugins built with -tags failinject") {
+		t.Errorf("fail_phases accepted by a release build: %q", err)
+	}
+
+	p := &Provisioner{config: Config{FailPhases: []string{"update", "install", "key_download"}}}
+	for _, phase := range p.config.FailPhases {
+		if err := p.injectFailure(phase); err != nil {
+			t.Errorf("%s failed in a release build: %v", phase, err)
+		}
+	}
+	if err := p.updateRemotePackageIndex(context.Background(), packer.TestUi(t), &fakeComm{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
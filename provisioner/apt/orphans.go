@@ -0,0 +1,58 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// maxOrphanPasses bounds the deborphan loop, since purging orphans can
+// orphan their own dependencies in turn.
+const maxOrphanPasses = 10
+
+func (p *Provisioner) removeRemoteOrphans(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if p.config.DryRun {
+		return p.reportRemoteOrphans(ctx, ui, comm)
+	}
+
+	if err := runRemoteCommand(ctx, ui, comm, p.aptCommand(noninteractive, "/usr/bin/apt-get install -y --no-install-recommends deborphan")); err != nil {
+		return fmt.Errorf("failed to install deborphan: %v", err)
+	}
+
+	for pass := 1; pass <= maxOrphanPasses; pass++ {
+		output, err := runRemoteOutput(ctx, comm, "/usr/bin/deborphan && /usr/bin/deborphan --find-config")
+		if err != nil {
+			return err
+		}
+		orphans := strings.Fields(output)
+		if len(orphans) == 0 {
+			return nil
+		}
+
+		ui.Say(fmt.Sprintf("Purging orphaned packages: %s", strings.Join(orphans, " ")))
+		if err := runRemoteCommand(ctx, ui, comm, p.aptCommand(noninteractive, "/usr/bin/apt-get purge -y "+strings.Join(orphans, " "))); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("orphaned packages remain after %d passes of deborphan", maxOrphanPasses)
+}
+
+// reportRemoteOrphans lists the orphans a dry run would purge first, without
+// installing deborphan when the guest doesn't have it.
+func (p *Provisioner) reportRemoteOrphans(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	output, err := runRemoteOutput(ctx, comm, "if [ -x /usr/bin/deborphan ]; then /usr/bin/deborphan && /usr/bin/deborphan --find-config; else echo -; fi")
+	if err != nil {
+		return err
+	}
+	switch orphans := strings.Fields(output); {
+	case len(orphans) == 1 && orphans[0] == "-":
+		ui.Say("Dry run, deborphan is not installed, skipping the removal of orphaned packages")
+	case len(orphans) == 0:
+		ui.Say("Dry run, no orphaned packages to purge")
+	default:
+		ui.Say(fmt.Sprintf("Dry run, skipping apt-get purge of orphaned packages: %s", strings.Join(orphans, " ")))
+	}
+	return nil
+}
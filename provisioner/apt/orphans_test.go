@@ -0,0 +1,58 @@
+package apt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestRemoveRemoteOrphans(t *testing.T) {
+	tests := []struct {
+		name   string
+		fail   string
+		purges int
+		err    string
+	}{
+		{name: "purges until none are left", purges: 2},
+		{name: "deborphan can't be installed", fail: "install -y --no-install-recommends deborphan", err: "failed to install deborphan"},
+		{name: "purge fails", fail: "apt-get purge", purges: 1, err: "apt-get purge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passes := 0
+			comm := &fakeComm{
+				status: failing(tt.fail),
+				output: func(command string) string {
+					if !strings.HasPrefix(command, "/usr/bin/deborphan") {
+						return ""
+					}
+					passes++
+					if passes > 2 {
+						return ""
+					}
+					return "libfoo1\n"
+				},
+			}
+			p := &Provisioner{}
+
+			err := p.removeRemoteOrphans(context.Background(), packer.TestUi(t), comm)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+			purges := 0
+			for _, command := range comm.commands {
+				if strings.Contains(command, "apt-get purge -y libfoo1") {
+					purges++
+				}
+			}
+			if purges != tt.purges {
+				t.Errorf("got %d purges, want %d:\n%s", purges, tt.purges, strings.Join(comm.commands, "\n"))
+			}
+		})
+	}
+}
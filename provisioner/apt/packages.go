@@ -0,0 +1,138 @@
+package apt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// packageSpecRe matches a package, optionally qualified by an architecture,
+// and pinned to a version (pkg=version) or a release (pkg/suite).
+var packageSpecRe = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+(:[a-z0-9-]+)?(=[A-Za-z0-9.+~:-]+|/[a-z0-9][a-z0-9.+-]*)?$`)
+
+// parsePackagesFile reads a packages file with one package per line. Each
+// line may pin a version with pkg=version, carry a trailing # comment, or
+// start with - to request removal instead of installation.
+func parsePackagesFile(r io.Reader) (install []string, remove []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		removal := strings.HasPrefix(line, "-")
+		if removal {
+			line = strings.TrimSpace(line[1:])
+		}
+		if !packageSpecRe.MatchString(line) {
+			return nil, nil, fmt.Errorf("line %d: invalid package entry %q", n, scanner.Text())
+		}
+
+		if removal {
+			remove = append(remove, line)
+		} else {
+			install = append(install, line)
+		}
+	}
+	return install, remove, scanner.Err()
+}
+
+// appendUnique appends the names not already present in list, keeping the
+// original order.
+func appendUnique(list []string, names ...string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, name := range list {
+		seen[name] = true
+	}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// reportGroups logs the packages of each selected group, so that a combined
+// install of several groups can still be followed group by group.
+func (c *Config) reportGroups(ui packer.Ui) {
+	for _, group := range c.InstallGroupsSelected {
+		ui.Say(fmt.Sprintf("Installing group %s: %s", group, strings.Join(c.PackageGroups[group], " ")))
+	}
+}
+
+// reportRemoteGroups reports, for each selected group, whether all of its
+// packages ended up installed. Packages can be missing after the install
+// when partial_install_policy let them fail.
+func (p *Provisioner) reportRemoteGroups(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var names []string
+	for _, group := range p.config.InstallGroupsSelected {
+		for _, spec := range p.config.PackageGroups[group] {
+			names = appendUnique(names, packageName(spec))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	output, err := runRemoteOutput(ctx, comm, fmt.Sprintf(
+		"/usr/bin/dpkg-query -W -f '${db:Status-Abbrev} ${binary:Package} ${Version}\\n' %s 2>/dev/null || true",
+		strings.Join(names, " "),
+	))
+	if err != nil {
+		return err
+	}
+	if p.config.Explain || p.config.DryRun {
+		return nil
+	}
+
+	installed := parseInstalledVersions(output)
+	for _, group := range p.config.InstallGroupsSelected {
+		var missing []string
+		for _, spec := range p.config.PackageGroups[group] {
+			if _, ok := installed[packageName(spec)]; !ok {
+				missing = append(missing, spec)
+			}
+		}
+		if len(missing) != 0 {
+			ui.Error(fmt.Sprintf("Group %s is incomplete, not installed: %s", group, strings.Join(missing, " ")))
+		} else {
+			ui.Say(fmt.Sprintf("Installed group %s: %s", group, strings.Join(p.config.PackageGroups[group], " ")))
+		}
+	}
+	return nil
+}
+
+func readPackagesFile(name string) ([]string, []string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	install, remove, err := parsePackagesFile(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return install, remove, nil
+}
@@ -0,0 +1,155 @@
+package apt
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestParsePackagesFile(t *testing.T) {
+	install, remove, err := parsePackagesFile(strings.NewReader(`# base
+curl
+nginx=1.22.1-9   # pinned
+- nano
+libc6:i386
+
+vim/bookworm-backports
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"curl", "nginx=1.22.1-9", "libc6:i386", "vim/bookworm-backports"}; !reflect.DeepEqual(install, want) {
+		t.Errorf("install %q, want %q", install, want)
+	}
+	if want := []string{"nano"}; !reflect.DeepEqual(remove, want) {
+		t.Errorf("remove %q, want %q", remove, want)
+	}
+
+	if _, _, err := parsePackagesFile(strings.NewReader("curl\nNot A Package\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
+
+func TestPrepareInstallGroups(t *testing.T) {
+	groups := map[string]interface{}{
+		"base": []string{"curl", "ca-certificates"},
+		"dev":  []string{"git", "curl", "build-essential"},
+	}
+	tests := []struct {
+		name     string
+		packages []string
+		selected []string
+		want     []string
+		err      string
+	}{
+		{
+			name:     "groups are merged without duplicates",
+			packages: []string{"vim", "git"},
+			selected: []string{"base", "dev"},
+			want:     []string{"vim", "git", "curl", "ca-certificates", "build-essential"},
+		},
+		{
+			name:     "no selected groups",
+			packages: []string{"vim"},
+			want:     []string{"vim"},
+		},
+		{
+			name:     "unknown group",
+			selected: []string{"base", "monitoring"},
+			err:      `install_groups_selected: unknown package group "monitoring"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := prepare(t, map[string]interface{}{
+				"packages":                tt.packages,
+				"package_groups":          groups,
+				"install_groups_selected": tt.selected,
+			})
+			if tt.err != "" {
+				if !strings.Contains(err, tt.err) {
+					t.Fatalf("expected error containing %q, got %q", tt.err, err)
+				}
+				return
+			}
+			if err != "" {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(p.config.Packages, tt.want) {
+				t.Errorf("packages %q, want %q", p.config.Packages, tt.want)
+			}
+		})
+	}
+}
+
+// recordingUi records what is said and reported as an error.
+type recordingUi struct {
+	packer.Ui
+	said   []string
+	errors []string
+}
+
+func (u *recordingUi) Say(msg string)   { u.said = append(u.said, msg) }
+func (u *recordingUi) Error(msg string) { u.errors = append(u.errors, msg) }
+
+func TestReportGroups(t *testing.T) {
+	c := &Config{
+		PackageGroups:         map[string][]string{"base": {"curl", "ca-certificates"}, "dev": {"git"}},
+		InstallGroupsSelected: []string{"base", "dev"},
+	}
+	ui := &recordingUi{}
+	c.reportGroups(ui)
+	want := []string{"Installing group base: curl ca-certificates", "Installing group dev: git"}
+	if !reflect.DeepEqual(ui.said, want) {
+		t.Errorf("said %q, want %q", ui.said, want)
+	}
+}
+
+func TestReportRemoteGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		said   []string
+		errors []string
+	}{
+		{
+			name:  "all installed",
+			query: "ii curl 7.88.1-10\nii ca-certificates 20230311\nii git 1:2.39.2-1.1\nii libc6:i386 2.36-9\n",
+			said: []string{
+				"Installed group base: curl=7.88.1-10 ca-certificates",
+				"Installed group dev: git libc6:i386",
+			},
+		},
+		{
+			name:   "failed and half-configured packages",
+			query:  "ii curl 7.88.1-10\niF ca-certificates 20230311\nii libc6:i386 2.36-9\n",
+			errors: []string{"Group base is incomplete, not installed: ca-certificates", "Group dev is incomplete, not installed: git"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm := &fakeComm{output: func(command string) string { return tt.query }}
+			p := &Provisioner{config: Config{
+				PackageGroups:         map[string][]string{"base": {"curl=7.88.1-10", "ca-certificates"}, "dev": {"git", "libc6:i386"}},
+				InstallGroupsSelected: []string{"base", "dev"},
+			}}
+			ui := &recordingUi{}
+
+			if err := p.reportRemoteGroups(context.Background(), ui, comm); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ui.said, tt.said) {
+				t.Errorf("said %q, want %q", ui.said, tt.said)
+			}
+			if !reflect.DeepEqual(ui.errors, tt.errors) {
+				t.Errorf("errors %q, want %q", ui.errors, tt.errors)
+			}
+			if want := "curl ca-certificates git libc6:i386 2>/dev/null"; len(comm.commands) != 1 || !strings.Contains(comm.commands[0], want) {
+				t.Errorf("commands %q don't query %q", comm.commands, want)
+			}
+		})
+	}
+}
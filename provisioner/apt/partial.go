@@ -0,0 +1,48 @@
+package apt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const processingErrorsHeader = "Errors were encountered while processing:"
+
+// failedPackages returns the packages dpkg lists after processingErrorsHeader
+// when some packages of an install failed to unpack or configure.
+func failedPackages(output string) []string {
+	var failed []string
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != processingErrorsHeader {
+			continue
+		}
+		for _, pkg := range lines[i+1:] {
+			if !strings.HasPrefix(pkg, " ") {
+				break
+			}
+			failed = appendUnique(failed, strings.TrimSpace(pkg))
+		}
+	}
+	return failed
+}
+
+// checkInstall applies partial_install_policy to a failed install. With
+// warn, packages that failed while the rest of the batch was installed are
+// reported and remembered for the summary, and provisioning continues.
+func (p *Provisioner) checkInstall(ui packer.Ui, output string, status int) error {
+	if status == 0 {
+		return nil
+	}
+	failed := failedPackages(output)
+	if len(failed) == 0 {
+		return fmt.Errorf("apt-get install exited with status %d", status)
+	}
+	if p.config.PartialInstallPolicy != "warn" {
+		return fmt.Errorf("apt-get install exited with status %d, packages failed to install: %s", status, strings.Join(failed, " "))
+	}
+	ui.Error(fmt.Sprintf("apt-get install exited with status %d, packages failed to install, continuing: %s", status, strings.Join(failed, " ")))
+	p.failedPackages = appendUnique(p.failedPackages, failed...)
+	return nil
+}
@@ -0,0 +1,105 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// packageDiff breaks the installed packages down by why they are present.
+type packageDiff struct {
+	// Requested are the packages of packages that are installed.
+	Requested []string `json:"requested"`
+	// Missing are the packages of packages that aren't installed.
+	Missing []string `json:"missing"`
+	// AutoInstalled are the packages apt installed as dependencies.
+	AutoInstalled []string `json:"auto_installed"`
+	// Unexpected are the manually installed packages that weren't requested,
+	// such as those of the base image.
+	Unexpected []string `json:"unexpected"`
+}
+
+// stripArch returns the package without its architecture qualifier, as
+// apt-mark and dpkg --get-selections only qualify some packages.
+func stripArch(name string) string {
+	return strings.SplitN(name, ":", 2)[0]
+}
+
+// diffPackages compares the requested packages with the output of apt-mark
+// showauto and dpkg --get-selections.
+func diffPackages(requested []string, showauto, selections string) packageDiff {
+	installed := make(map[string]bool)
+	for _, line := range strings.Split(selections, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "install" {
+			installed[stripArch(fields[0])] = true
+		}
+	}
+	auto := make(map[string]bool)
+	for _, name := range strings.Fields(showauto) {
+		auto[stripArch(name)] = true
+	}
+
+	diff := packageDiff{Requested: []string{}, Missing: []string{}, AutoInstalled: []string{}, Unexpected: []string{}}
+	wanted := make(map[string]bool)
+	for _, spec := range requested {
+		name := stripArch(packageName(spec))
+		if wanted[name] {
+			continue
+		}
+		wanted[name] = true
+		if installed[name] {
+			diff.Requested = append(diff.Requested, name)
+		} else {
+			diff.Missing = append(diff.Missing, name)
+		}
+	}
+	for name := range installed {
+		switch {
+		case wanted[name]:
+		case auto[name]:
+			diff.AutoInstalled = append(diff.AutoInstalled, name)
+		default:
+			diff.Unexpected = append(diff.Unexpected, name)
+		}
+	}
+	for _, list := range [][]string{diff.Requested, diff.Missing, diff.AutoInstalled, diff.Unexpected} {
+		sort.Strings(list)
+	}
+	return diff
+}
+
+// writePackageDiff writes the breakdown of the installed packages as JSON to
+// package_diff_report on the host.
+func (p *Provisioner) writePackageDiff(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Writing the requested and resolved packages to %s", p.config.PackageDiffReport))
+	showauto, err := runRemoteOutput(ctx, comm, "/usr/bin/apt-mark showauto")
+	if err != nil {
+		return err
+	}
+	selections, err := runRemoteOutput(ctx, comm, "/usr/bin/dpkg --get-selections")
+	if err != nil {
+		return err
+	}
+	if p.config.Explain {
+		return nil
+	}
+
+	diff := diffPackages(p.config.Packages, showauto, selections)
+	ui.Say(fmt.Sprintf("%d requested, %d missing, %d automatically installed and %d other packages",
+		len(diff.Requested), len(diff.Missing), len(diff.AutoInstalled), len(diff.Unexpected)))
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(diff); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.config.PackageDiffReport, buf.Bytes(), 0644)
+}
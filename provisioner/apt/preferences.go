@@ -0,0 +1,92 @@
+package apt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const preferencesFile = "/etc/apt/preferences.d/packer"
+
+// validate checks that a preference has a package, a pin of one of the forms
+// apt_preferences(5) knows and a priority, all on a single line.
+func (p Preference) validate() error {
+	if p.Package == "" || strings.ContainsAny(p.Package, "\n") {
+		return fmt.Errorf("invalid package: %q", p.Package)
+	}
+	if fields := strings.Fields(p.Pin); strings.Contains(p.Pin, "\n") || len(fields) < 2 ||
+		(fields[0] != "release" && fields[0] != "version" && fields[0] != "origin") {
+		return fmt.Errorf("pin for %s must be a release, version or origin pin: %q", p.Package, p.Pin)
+	}
+	if p.PinPriority == 0 {
+		return fmt.Errorf("pin for %s needs a non-zero pin_priority", p.Package)
+	}
+	return nil
+}
+
+// renderPreferences renders the configured pins as apt_preferences(5)
+// stanzas, or returns an empty string when there is nothing to pin.
+func (c *Config) renderPreferences() string {
+	var stanzas []string
+	for _, pin := range c.OriginPins {
+		stanzas = append(stanzas, fmt.Sprintf(
+			"Package: *\nPin: release o=%s\nPin-Priority: %d\n",
+			pin.Origin, pin.Priority,
+		))
+	}
+	for _, pref := range c.Preferences {
+		stanzas = append(stanzas, fmt.Sprintf(
+			"Package: %s\nPin: %s\nPin-Priority: %d\n",
+			pref.Package, pref.Pin, pref.PinPriority,
+		))
+	}
+	for _, pkg := range sortedKeys(c.ExcludeDependencies) {
+		for _, dep := range c.ExcludeDependencies[pkg] {
+			stanzas = append(stanzas, fmt.Sprintf(
+				"Explanation: excluded for %s\nPackage: %s\nPin: release *\nPin-Priority: -1\n",
+				pkg, dep,
+			))
+		}
+	}
+	// A version glob pinned above 1000 makes the highest matching version
+	// the candidate, even when that is a downgrade.
+	for _, pkg := range sortedStringKeys(c.VersionRanges) {
+		stanzas = append(stanzas, fmt.Sprintf(
+			"Explanation: version range for %s\nPackage: %s\nPin: version %s\nPin-Priority: 1001\n",
+			pkg, pkg, c.VersionRanges[pkg],
+		))
+	}
+	return strings.Join(stanzas, "\n")
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *Provisioner) uploadPreferences(ui packer.Ui, comm packer.Communicator) error {
+	preferences := p.config.renderPreferences()
+	if preferences == "" {
+		return nil
+	}
+	if err := comm.Upload(preferencesFile, strings.NewReader(preferences), nil); err != nil {
+		return err
+	}
+	p.preferencesUploaded = true
+	return nil
+}
@@ -0,0 +1,96 @@
+package apt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderPreferences(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{name: "nothing to pin"},
+		{
+			name: "excluded dependencies are pinned negative",
+			config: Config{ExcludeDependencies: map[string][]string{
+				"nginx":   {"nginx-doc"},
+				"gnupg":   {"dirmngr", "gnupg-l10n"},
+				"nothing": {},
+			}},
+			want: "Explanation: excluded for gnupg\nPackage: dirmngr\nPin: release *\nPin-Priority: -1\n" +
+				"\n" +
+				"Explanation: excluded for gnupg\nPackage: gnupg-l10n\nPin: release *\nPin-Priority: -1\n" +
+				"\n" +
+				"Explanation: excluded for nginx\nPackage: nginx-doc\nPin: release *\nPin-Priority: -1\n",
+		},
+		{
+			name: "every kind of pin",
+			config: Config{
+				OriginPins:          []OriginPin{{Origin: "packages.example.com", Priority: 900}},
+				Preferences:         []Preference{{Package: "curl", Pin: "release a=bookworm-backports", PinPriority: 500}},
+				ExcludeDependencies: map[string][]string{"git": {"git-man"}},
+				VersionRanges:       map[string]string{"nodejs": "18.*"},
+			},
+			want: "Package: *\nPin: release o=packages.example.com\nPin-Priority: 900\n" +
+				"\n" +
+				"Package: curl\nPin: release a=bookworm-backports\nPin-Priority: 500\n" +
+				"\n" +
+				"Explanation: excluded for git\nPackage: git-man\nPin: release *\nPin-Priority: -1\n" +
+				"\n" +
+				"Explanation: version range for nodejs\nPackage: nodejs\nPin: version 18.*\nPin-Priority: 1001\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.renderPreferences(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferenceValidate(t *testing.T) {
+	tests := []struct {
+		pref Preference
+		err  string
+	}{
+		{pref: Preference{Package: "curl", Pin: "version 7.88.*", PinPriority: 1001}},
+		{pref: Preference{Package: "*", Pin: "origin deb.debian.org", PinPriority: -1}},
+		{pref: Preference{Pin: "version 1.0", PinPriority: 500}, err: "invalid package"},
+		{pref: Preference{Package: "curl", Pin: "version", PinPriority: 500}, err: "must be a release, version or origin pin"},
+		{pref: Preference{Package: "curl", Pin: "suite bookworm", PinPriority: 500}, err: "must be a release, version or origin pin"},
+		{pref: Preference{Package: "curl", Pin: "version 1.0\nPin-Priority: 1001", PinPriority: 500}, err: "must be a release, version or origin pin"},
+		{pref: Preference{Package: "curl", Pin: "version 1.0"}, err: "needs a non-zero pin_priority"},
+	}
+	for _, tt := range tests {
+		err := tt.pref.validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%+v: unexpected error: %v", tt.pref, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%+v: expected error containing %q, got %v", tt.pref, tt.err, err)
+		}
+	}
+}
+
+func TestPrepareExcludeDependencies(t *testing.T) {
+	for deps, want := range map[string]string{
+		"nginx-doc":      "",
+		"nginx doc":      `invalid package name in exclude_dependencies: "nginx doc"`,
+		"Nginx-Doc":      `invalid package name in exclude_dependencies: "Nginx-Doc"`,
+		"nginx-doc\nfoo": `invalid package name in exclude_dependencies`,
+	} {
+		_, err := prepare(t, map[string]interface{}{
+			"packages":             []string{"nginx"},
+			"exclude_dependencies": map[string][]string{"nginx": {deps}},
+		})
+		if want == "" && err != "" {
+			t.Errorf("%q: unexpected error: %s", deps, err)
+		}
+		if !strings.Contains(err, want) {
+			t.Errorf("%q: expected error containing %q, got %q", deps, want, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package apt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// debconfTypes are the question types debconf-set-selections(1) accepts.
+var debconfTypes = map[string]bool{
+	"boolean":     true,
+	"error":       true,
+	"multiselect": true,
+	"note":        true,
+	"password":    true,
+	"select":      true,
+	"string":      true,
+	"text":        true,
+	"title":       true,
+	"seen":        true,
+}
+
+// parseSelection checks a debconf selections line of the form owner
+// question type value and returns its type and value.
+func parseSelection(line string) (string, string, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || strings.HasPrefix(fields[1], "/") || !strings.Contains(fields[1], "/") {
+		return "", "", fmt.Errorf("invalid debconf selection %q, expected owner question type value", line)
+	}
+	if !debconfTypes[fields[2]] {
+		return "", "", fmt.Errorf("invalid debconf selection %q, unknown type %s", line, fields[2])
+	}
+	value := ""
+	if len(fields) > 3 {
+		value = strings.Join(fields[3:], " ")
+	}
+	return fields[2], value, nil
+}
+
+// parsePreseedFile reads a debconf selections file, ignoring blank lines and
+// # comments.
+func parsePreseedFile(r io.Reader) ([]string, error) {
+	var selections []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, err := parseSelection(line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		selections = append(selections, line)
+	}
+	return selections, scanner.Err()
+}
+
+func readPreseedFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	selections, err := parsePreseedFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return selections, nil
+}
+
+// preseedRemoteDebconf feeds the selections to debconf-set-selections in
+// the order they are configured.
+func (p *Provisioner) preseedRemoteDebconf(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Preseeding %d debconf selections", len(p.config.preseedSelections)))
+	cmd := &packer.RemoteCmd{
+		Command: "/usr/bin/debconf-set-selections",
+		Stdin:   strings.NewReader(strings.Join(p.config.preseedSelections, "\n") + "\n"),
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("debconf-set-selections failed with exit status %d", status)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// probeURI returns the repository URI a source_probes key names: either a
+// source line as given in sources, or just its URI.
+func probeURI(key string) string {
+	if s, ok := parseSourceLine(key); ok {
+		key = s.URI
+	}
+	return strings.TrimSuffix(key, "/")
+}
+
+// candidateURIs returns the candidate version apt-cache policy reports for
+// a package, and the repositories that provide that version.
+func candidateURIs(policy string) (string, []string) {
+	var candidate string
+	var uris []string
+	inCandidate := false
+	for _, line := range strings.Split(policy, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "Candidate:":
+			candidate = fields[1]
+		case candidate == "" || len(fields) == 0:
+		case fields[0] == "***" && len(fields) >= 2:
+			inCandidate = fields[1] == candidate
+		case len(fields) == 2:
+			// A version line: "<version> <priority>".
+			inCandidate = fields[0] == candidate
+		case inCandidate && len(fields) >= 4 && strings.Contains(fields[1], ":"):
+			// A repository line: "<priority> <uri> <suite> <arch> Packages".
+			uris = append(uris, strings.TrimSuffix(fields[1], "/"))
+		}
+	}
+	return candidate, uris
+}
+
+// probeRemoteSources checks that each probe package of source_probes can be
+// installed, simulated, and that its candidate comes from the source.
+func (p *Provisioner) probeRemoteSources(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	for _, key := range sortedStringKeys(p.config.SourceProbes) {
+		pkg, uri := p.config.SourceProbes[key], probeURI(key)
+		ui.Say(fmt.Sprintf("Probing %s with %s", uri, pkg))
+
+		if _, err := runRemoteOutput(ctx, comm, p.aptCommand(nil, "/usr/bin/apt-get install -s "+pkg)); err != nil {
+			return fmt.Errorf("probe package %s of %s can't be installed: %v", pkg, uri, err)
+		}
+		policy, err := runRemoteOutput(ctx, comm, p.aptCommand(nil, "/usr/bin/apt-cache policy "+pkg))
+		if err != nil {
+			return err
+		}
+		if p.config.Explain {
+			continue
+		}
+		// apt reports the URIs as rewritten for transport_method.
+		candidate, uris := candidateURIs(policy)
+		if !containsString(uris, transportMethods[p.config.TransportMethod].rewriteURI(uri)) {
+			return fmt.Errorf("probe package %s %s resolves from %s instead of %s", pkg, candidate, strings.Join(uris, ", "), uri)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package apt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// statusUi translates the lines apt writes to APT::Status-Fd into short
+// progress messages and passes everything else through unchanged.
+type statusUi struct {
+	packer.Ui
+	phase   string
+	percent int
+}
+
+func newStatusUi(ui packer.Ui) *statusUi {
+	return &statusUi{Ui: ui, percent: -1}
+}
+
+func (u *statusUi) Message(line string) {
+	phase, percent, ok := parseStatusLine(line)
+	if !ok {
+		u.Ui.Message(line)
+		return
+	}
+	if phase == u.phase && percent == u.percent {
+		return
+	}
+	u.phase, u.percent = phase, percent
+	u.Ui.Say(fmt.Sprintf("%s: %d%%", phase, percent))
+}
+
+// parseStatusLine parses a status-fd line of the form
+// "pmstatus:<package>:<percent>:<description>" or the dlstatus equivalent.
+// The package may be qualified with its architecture, as in libc6:amd64, so
+// the percent is the first number after it.
+func parseStatusLine(line string) (string, int, bool) {
+	fields := strings.Split(line, ":")
+	if len(fields) < 4 {
+		return "", 0, false
+	}
+
+	var phase string
+	switch fields[0] {
+	case "dlstatus":
+		phase = "Downloading"
+	case "pmstatus":
+		phase = "Installing"
+	default:
+		return "", 0, false
+	}
+
+	for _, field := range fields[2 : len(fields)-1] {
+		if percent, err := strconv.ParseFloat(field, 64); err == nil {
+			return phase, int(percent), true
+		}
+	}
+	return "", 0, false
+}
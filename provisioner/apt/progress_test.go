@@ -0,0 +1,51 @@
+package apt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatusLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		phase   string
+		percent int
+		ok      bool
+	}{
+		{"dlstatus:1:9.0909:Retrieving file 1 of 11", "Downloading", 9, true},
+		{"dlstatus:11:100:Retrieving file 11 of 11", "Downloading", 100, true},
+		{"pmstatus:dpkg-exec:0:Running dpkg", "Installing", 0, true},
+		{"pmstatus:tzdata:45.4545:Unpacking tzdata (all)", "Installing", 45, true},
+		{"pmstatus:libc6:amd64:62.5:Configuring libc6:amd64", "Installing", 62, true},
+		{"pmconffile:/etc/foo.conf:/etc/foo.conf.dpkg-new:useredited distedited", "", 0, false},
+		{"pmerror:/var/cache/apt/archives/foo.deb:50:trying to overwrite /usr/bin/foo", "", 0, false},
+		{"media-change:cdrom:label", "", 0, false},
+		{"pmstatus:tzdata:unknown:Unpacking", "", 0, false},
+		{"Setting up tzdata (2024a-0+deb12u1) ...", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		phase, percent, ok := parseStatusLine(tt.line)
+		if phase != tt.phase || percent != tt.percent || ok != tt.ok {
+			t.Errorf("parseStatusLine(%q) = %q, %d, %v, want %q, %d, %v",
+				tt.line, phase, percent, ok, tt.phase, tt.percent, tt.ok)
+		}
+	}
+}
+
+func TestStatusUi(t *testing.T) {
+	ui := &recordingUi{}
+	status := newStatusUi(ui)
+	for _, line := range []string{
+		"dlstatus:1:50:Retrieving file 1 of 2",
+		"dlstatus:1:50.2:Retrieving file 1 of 2",
+		"dlstatus:2:100:Retrieving file 2 of 2",
+		"pmstatus:tzdata:100:Installed tzdata (all)",
+	} {
+		status.Message(line)
+	}
+	want := []string{"Downloading: 50%", "Downloading: 100%", "Installing: 100%"}
+	if !reflect.DeepEqual(ui.said, want) {
+		t.Errorf("said %q, want %q", ui.said, want)
+	}
+}
@@ -1,21 +1,41 @@
 package apt
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 type Provisioner struct {
-	config Config
-	comm   packer.Communicator
+	config       Config
+	comm         packer.Communicator
+	aptConfFiles []string
+	facts        *guestFacts
+	cacheDir     string
+
+	updateTranscript syncBuffer
+	injectedFailures map[string]int
+	failedPackages   []string
+	dpkgLogOffset    int64
+
+	ephemeralStateDir string
+	keyFiles          []string
+
+	preferencesUploaded bool
+
+	// mu guards the state updated by concurrent key uploads.
+	mu sync.Mutex
 }
 
 func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
@@ -27,29 +47,236 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator, _ map[string]interface{}) error {
 	ui.Say("Provisioning with APT...")
 
-	if err := p.uploadHostPackageCache(ui, comm); err != nil {
-		ui.Error(fmt.Sprintf("Failed to upload APT cache from %s", p.config.CacheDir))
+	if p.config.Explain {
+		ui.Say("Explain mode, listing the provisioning steps without running them")
+		comm = &explainCommunicator{ui: ui}
+		p.facts = explainFacts
+	}
+
+	if p.config.UseSudo {
+		comm = &sudoCommunicator{Communicator: comm, sudo: p.config.SudoCommand}
+	}
+
+	if p.config.Proxy != "" || p.config.HTTPSProxy != "" {
+		if err := p.uploadProxy(comm); err != nil {
+			ui.Error("Failed to upload APT proxy configuration")
+			return err
+		}
+	}
+
+	if p.config.DryRun {
+		ui.Say("Dry run, simulating installs, upgrades and removals without changing the packages of the image")
+	}
+
+	if p.config.ForceYes {
+		ui.Error("WARNING: force_yes is set, apt may remove essential packages, change held packages " +
+			"and downgrade packages without asking")
+	}
+
+	if p.config.EnsureQemuUserStatic {
+		if err := p.ensureQemuUserStatic(ui, comm); err != nil {
+			ui.Error("Failed to set up emulation for the target architecture")
+			return err
+		}
+	}
+
+	if p.config.RequireNetwork {
+		if err := p.requireRemoteNetwork(ctx, ui, comm); err != nil {
+			ui.Error("Network check failed")
+			return err
+		}
+	}
+
+	if err := p.requireAptVersion(ctx, ui, comm); err != nil {
+		ui.Error("APT version check failed")
 		return err
 	}
 
-	if err := p.uploadHostPackageTrust(ui, comm); err != nil {
+	if err := p.resolveCacheDir(ctx, ui, comm); err != nil {
+		ui.Error("Failed to detect the target distribution")
 		return err
 	}
 
-	if err := p.testRemoteDNS(ctx, ui, comm); err != nil {
+	if p.config.EphemeralAptState {
+		if err := p.setupEphemeralState(ctx, ui, comm); err != nil {
+			ui.Error("Failed to set up ephemeral APT state")
+			return err
+		}
+	}
+
+	if p.config.CaptureDpkgLog != "" {
+		if err := p.snapshotDpkgLog(ctx, comm); err != nil {
+			ui.Error("Failed to read the size of the dpkg log")
+			return err
+		}
+	}
+
+	if p.config.DumpResolvedConfig != "" && !p.config.Explain {
+		if err := p.dumpResolvedConfig(); err != nil {
+			ui.Error(fmt.Sprintf("Failed to dump the resolved configuration to %s", p.config.DumpResolvedConfig))
+			return err
+		}
+	}
+
+	if p.config.UploadCache.False() && p.config.WritebackCache.False() {
+		ui.Say("Skipping APT cache upload and write-back")
+	} else if !p.config.UploadCache.False() {
+		if err := p.uploadHostPackageCache(ctx, ui, comm); err != nil {
+			ui.Error(fmt.Sprintf("Failed to upload APT cache from %s", p.cacheDir))
+			return err
+		}
+	}
+
+	if err := p.uploadHostPackageTrust(ctx, ui, comm); err != nil {
+		return err
+	}
+
+	if p.config.MigrateLegacyKeys {
+		if err := p.migrateRemoteLegacyKeys(ctx, ui, comm); err != nil {
+			ui.Error("Failed to migrate legacy APT keys")
+			return err
+		}
+	}
+
+	if p.config.WaitForDNS.False() {
+		ui.Say("wait_for_dns is disabled, skipping domain name resolution check")
+	} else if onlyLocalSources(p.config.sourceLines()) {
+		ui.Say("Only file:// APT sources configured, skipping domain name resolution check")
+	} else if err := p.testRemoteDNS(ctx, ui, comm); err != nil {
 		ui.Error("Failed waiting for domain name resolution")
 		return err
 	}
 
-	if len(p.config.Sources) != 0 {
-		if err := p.uploadPackageList(ui, comm); err != nil {
+	if err := p.uploadPreferences(ui, comm); err != nil {
+		ui.Error("Failed to upload APT preferences")
+		return err
+	}
+
+	if p.config.DefaultRelease != "" {
+		if err := p.uploadDefaultRelease(comm); err != nil {
+			ui.Error("Failed to upload APT default release configuration")
+			return err
+		}
+	}
+
+	if p.config.MaxDownloadsPerHost != 0 {
+		if err := p.uploadDownloadLimits(comm); err != nil {
+			ui.Error("Failed to upload APT download limits")
+			return err
+		}
+	}
+
+	if err := p.runRemoteHooks(ctx, ui, comm, "pre_commands", p.config.PreCommands); err != nil {
+		ui.Error("A pre_commands command failed")
+		return err
+	}
+
+	if len(p.config.Architectures) != 0 {
+		if err := p.addRemoteArchitectures(ctx, ui, comm); err != nil {
+			ui.Error("Failed to add foreign architectures")
+			return err
+		}
+	}
+
+	if p.config.TransportMethod != "" && p.config.refreshesIndex() {
+		if err := p.installRemoteTransport(ctx, ui, comm); err != nil {
+			ui.Error(fmt.Sprintf("Failed to install the %s transport method", p.config.TransportMethod))
+			return err
+		}
+	}
+
+	if p.config.refreshesIndex() {
+		if err := p.uploadPackageList(ctx, ui, comm); err != nil {
 			ui.Error("Failed to upload APT package list")
 			return err
 		}
+		if err := p.checkRemoteKeyrings(ctx, ui, comm); err != nil {
+			ui.Error("Missing keyrings for APT sources")
+			return err
+		}
+		if err := p.checkRemoteLocalSources(ctx, ui, comm); err != nil {
+			ui.Error("Missing file:// APT repositories")
+			return err
+		}
+		if p.config.ListsCacheDir != "" {
+			if err := p.uploadHostListsCache(ui, comm); err != nil {
+				ui.Error(fmt.Sprintf("Failed to upload APT lists cache from %s", p.config.ListsCacheDir))
+				return err
+			}
+		}
 		if err := p.updateRemotePackageIndex(ctx, ui, comm); err != nil {
 			ui.Error("apt-get update failed")
 			return err
 		}
+		if len(p.config.SourceProbes) != 0 {
+			if err := p.probeRemoteSources(ctx, ui, comm); err != nil {
+				ui.Error("APT source probe failed")
+				return err
+			}
+		}
+		if p.config.ListsCacheDir != "" {
+			if err := p.updateListsCache(ctx, ui, comm); err != nil {
+				ui.Error(fmt.Sprintf("Failed to update APT lists cache in %s", p.config.ListsCacheDir))
+				return err
+			}
+		}
+	}
+
+	if p.config.FixBroken {
+		if err := p.fixBroken(ctx, ui, comm); err != nil {
+			ui.Error("Failed to repair broken packages")
+			return err
+		}
+	}
+
+	if err := p.ensureRemoteFrontend(ctx, ui, comm); err != nil {
+		ui.Error("Failed to install nala")
+		return err
+	}
+
+	if p.config.Solver != "" {
+		if err := p.ensureRemoteSolver(ctx, ui, comm); err != nil {
+			ui.Error("Failed to set up the APT solver")
+			return err
+		}
+	}
+
+	if len(p.config.GrubInstallDevices) != 0 {
+		if err := p.preseedGrubInstallDevices(ctx, ui, comm); err != nil {
+			ui.Error("Failed to preseed grub-pc install devices")
+			return err
+		}
+	}
+
+	if len(p.config.preseedSelections) != 0 {
+		if err := p.preseedRemoteDebconf(ctx, ui, comm); err != nil {
+			ui.Error("Failed to preseed debconf")
+			return err
+		}
+	}
+
+	if p.config.Upgrade != "none" && p.config.UpgradeOrder == "before" {
+		if err := p.upgrade(ctx, ui, comm); err != nil {
+			return err
+		}
+	}
+
+	if p.config.ProcessTriggers {
+		if err := p.processRemoteTriggers(ctx, ui, comm); err != nil {
+			ui.Error("dpkg --configure --pending failed")
+			return err
+		}
+	}
+
+	if p.config.ReportGroups {
+		p.config.reportGroups(ui)
+	}
+
+	if p.config.PrintURIs != "" {
+		if err := p.savePrintURIs(ctx, ui, comm); err != nil {
+			ui.Error(fmt.Sprintf("Failed to write package URIs to %s", p.config.PrintURIs))
+			return err
+		}
 	}
 
 	if err := p.installRemotePackages(ctx, ui, comm); err != nil {
@@ -57,23 +284,204 @@ func (p *Provisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.C
 		return err
 	}
 
-	if err := p.updateCache(ui, comm); err != nil {
+	if p.config.ReportGroups {
+		if err := p.reportRemoteGroups(ctx, ui, comm); err != nil {
+			ui.Error("Failed to check the installed package groups")
+			return err
+		}
+	}
+
+	if p.config.SecurityBaseline {
+		if err := p.uploadSecurityBaseline(ui, comm); err != nil {
+			ui.Error("Failed to configure unattended-upgrades")
+			return err
+		}
+	}
+
+	if err := p.installRemoteDebs(ctx, ui, comm, p.config.DebFiles); err != nil {
+		ui.Error("Failed to install local .deb files")
+		return err
+	}
+
+	if len(p.config.GitHubReleaseDebs) != 0 {
+		if err := p.installGitHubReleaseDebs(ctx, ui, comm); err != nil {
+			ui.Error("Failed to install .deb files from GitHub releases")
+			return err
+		}
+	}
+
+	if p.config.Upgrade != "none" && p.config.UpgradeOrder == "after" {
+		if err := p.upgrade(ctx, ui, comm); err != nil {
+			return err
+		}
+	}
+
+	if p.config.DKMSKernelVersion != "" {
+		if err := p.buildRemoteDKMSModules(ctx, ui, comm); err != nil {
+			ui.Error("Failed to build DKMS modules")
+			return err
+		}
+	}
+
+	if err := p.runRemoteHooks(ctx, ui, comm, "post_commands", p.config.PostCommands); err != nil {
+		ui.Error("A post_commands command failed")
+		return err
+	}
+
+	if err := p.removeRemotePackages(ctx, ui, comm, "remove", p.config.Remove); err != nil {
+		ui.Error("apt-get remove failed.")
 		return err
 	}
 
-	if err := p.cleanRemotePackages(ctx, ui, comm); err != nil {
-		ui.Error("apt-get clean failed, ignoring")
+	if err := p.removeRemotePackages(ctx, ui, comm, "purge", p.config.Purge); err != nil {
+		ui.Error("apt-get purge failed.")
+		return err
+	}
+
+	if len(p.config.Hold) != 0 {
+		if err := p.holdRemotePackages(ctx, ui, comm); err != nil {
+			ui.Error("apt-mark hold failed.")
+			return err
+		}
+	}
+
+	if p.config.LockfileOut != "" {
+		if err := p.writeLockfile(ctx, ui, comm); err != nil {
+			ui.Error(fmt.Sprintf("Failed to write lockfile %s", p.config.LockfileOut))
+			return err
+		}
+	}
+
+	if p.config.LicenseReport != "" {
+		if err := p.writeLicenseReport(ctx, ui, comm); err != nil {
+			ui.Error(fmt.Sprintf("Failed to write license report %s", p.config.LicenseReport))
+			return err
+		}
+	}
+
+	if p.config.PackageDiffReport != "" {
+		if err := p.writePackageDiff(ctx, ui, comm); err != nil {
+			ui.Error(fmt.Sprintf("Failed to write package diff report %s", p.config.PackageDiffReport))
+			return err
+		}
+	}
+
+	if p.config.RemoveOrphans {
+		if err := p.removeRemoteOrphans(ctx, ui, comm); err != nil {
+			ui.Error("Failed to remove orphaned packages")
+			return err
+		}
+	}
+
+	if p.config.VerifyDebsums {
+		if err := p.verifyRemoteDebsums(ctx, ui, comm); err != nil {
+			ui.Error("Package file verification failed")
+			return err
+		}
+	}
+
+	if err := p.manageRemoteServices(ctx, ui, comm); err != nil {
+		ui.Error("systemctl failed")
 		return err
 	}
 
+	if p.config.RebootIfRequired {
+		if err := p.rebootIfRequired(ctx, ui, comm); err != nil {
+			ui.Error("Failed to reboot the guest")
+			return err
+		}
+	}
+
+	if !p.config.WritebackCache.False() && !p.config.DryRun {
+		if err := p.updateCache(ctx, ui, comm); err != nil {
+			return err
+		}
+	}
+
+	if p.config.ReproducibleCacheExport != "" && !p.config.Explain {
+		ui.Say(fmt.Sprintf("Exporting APT cache to %s", p.config.ReproducibleCacheExport))
+		if err := writeReproducibleTar(p.cacheDir, p.config.ReproducibleCacheExport); err != nil {
+			ui.Error(fmt.Sprintf("Failed to export APT cache to %s", p.config.ReproducibleCacheExport))
+			return err
+		}
+	}
+
+	if p.config.Autoremove && !p.config.DryRun {
+		ui.Say("Removing automatically installed packages that are no longer needed")
+		if err := p.autoremoveRemotePackages(ctx, ui, comm); err != nil {
+			ui.Error("apt-get autoremove failed.")
+			return err
+		}
+	}
+
+	if !p.config.DryRun {
+		ui.Say("Cleaning the APT archive cache")
+		if err := p.cleanRemotePackages(ctx, ui, comm); err != nil {
+			if err := p.softFail(ui, fmt.Sprintf("apt-get clean failed: %v", err)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.config.CaptureDpkgLog != "" {
+		if err := p.captureDpkgLog(ctx, ui, comm); err != nil {
+			ui.Error(fmt.Sprintf("Failed to write the dpkg log to %s", p.config.CaptureDpkgLog))
+			return err
+		}
+	}
+
+	if err := removeRemoteFiles(ctx, ui, comm, p.cleanupFiles()); err != nil {
+		ui.Error(fmt.Sprintf("Failed to remove APT configuration, ignoring: %v", err))
+	}
+
+	if p.config.VerifyCleanup {
+		if err := p.verifyRemoteCleanup(ctx, ui, comm); err != nil {
+			ui.Error("Cleanup verification failed")
+			return err
+		}
+	}
+
+	if p.config.AssertConsistent {
+		if err := p.assertRemoteConsistent(ctx, ui, comm); err != nil {
+			ui.Error("Dependency consistency check failed")
+			return err
+		}
+	}
+
+	if p.config.SlimImage {
+		if err := p.slimRemoteImage(ctx, ui, comm); err != nil {
+			ui.Error("Failed to slim the image")
+			return err
+		}
+	}
+
+	if p.config.TrimFreeSpace && !p.config.DryRun {
+		if err := p.trimRemoteFreeSpace(ctx, ui, comm); err != nil {
+			return err
+		}
+	}
+
+	if len(p.failedPackages) != 0 {
+		ui.Error(fmt.Sprintf("Provisioned without packages that failed to install: %s", strings.Join(p.failedPackages, " ")))
+	}
+
 	return nil
 }
 
-func (p *Provisioner) updateCache(ui packer.Ui, comm packer.Communicator) error {
-	_, err := os.Stat(p.config.CacheDir)
+// softFail reports a condition that is only fatal in strict mode.
+func (p *Provisioner) softFail(ui packer.Ui, msg string) error {
+	if p.config.Strict {
+		ui.Error(msg)
+		return errors.New(msg)
+	}
+	ui.Say(msg + ", ignoring")
+	return nil
+}
+
+func (p *Provisioner) updateCache(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	_, err := os.Stat(p.cacheDir)
 	if os.IsNotExist(err) {
-		ui.Say("Skipping updating package cache, likely not running on a debian based host.")
-		return nil
+		return p.softFail(ui, "Skipping updating package cache, likely not running on a debian based host")
 	} else if err != nil {
 		return err
 	}
@@ -85,115 +493,635 @@ func (p *Provisioner) updateCache(ui packer.Ui, comm packer.Communicator) error
 	}
 	defer os.RemoveAll(dir)
 
-	if err := comm.DownloadDir("/var/cache/apt/archives", dir, []string{}); err != nil {
-		ui.Error(fmt.Sprintf("APT cache update: failed to download archives to %s", dir))
+	remote, err := runRemoteOutput(ctx, comm, "/bin/ls -1 "+p.archivesDir())
+	if err != nil {
+		ui.Error("APT cache update: failed to list remote archives")
+		return err
+	}
+
+	fresh, err := cacheDelta(p.cacheDir, strings.Fields(remote))
+	if err != nil {
 		return err
 	}
+	if len(fresh) == 0 {
+		ui.Say("APT cache update: no new packages to download")
+		return nil
+	}
 
-	cmd := exec.Command("/bin/sh", "-c", fmt.Sprintf("mv -n %s/*.deb %s", dir, p.config.CacheDir))
-	if err := cmd.Run(); err != nil {
-		ui.Error(fmt.Sprintf("APT cache update: mv: %v", err))
+	for _, name := range fresh {
+		if err := downloadFile(comm, path.Join(p.archivesDir(), name), filepath.Join(dir, name)); err != nil {
+			ui.Error(fmt.Sprintf("APT cache update: failed to download %s to %s", name, dir))
+			return err
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
 		return err
 	}
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || filepath.Ext(entry.Name()) != ".deb" {
+			continue
+		}
+		if err := moveFile(filepath.Join(dir, entry.Name()), filepath.Join(p.cacheDir, entry.Name())); err != nil {
+			ui.Error(fmt.Sprintf("APT cache update: failed to move %s to %s", entry.Name(), p.cacheDir))
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (p *Provisioner) uploadHostPackageCache(ui packer.Ui, comm packer.Communicator) error {
-	cache, err := os.Stat(p.config.CacheDir)
-	if os.IsNotExist(err) {
-		ui.Say("Host APT package cache not found, likely not running on a debian based host. Proceeding regardless")
+// moveFile moves src to dst unless dst already exists, copying when the two
+// are on different filesystems.
+func moveFile(src string, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
 		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// cacheDelta returns the .deb files among names that are not yet present in
+// the host cache dir.
+func cacheDelta(cacheDir string, names []string) ([]string, error) {
+	var fresh []string
+	for _, name := range names {
+		if filepath.Ext(name) != ".deb" {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(cacheDir, name))
+		if os.IsNotExist(err) {
+			fresh = append(fresh, name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return fresh, nil
+}
+
+func downloadFile(comm packer.Communicator, src string, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := comm.Download(src, f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (p *Provisioner) uploadHostPackageCache(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	cache, err := os.Stat(p.cacheDir)
+	if os.IsNotExist(err) {
+		return p.softFail(ui, "Host APT package cache not found, likely not running on a debian based host")
 	} else if err != nil {
 		return err
 	}
 
 	if err == nil && cache.IsDir() {
-		err := comm.UploadDir("/var/cache/apt/archives", p.config.CacheDir, []string{})
+		if p.config.ValidateCacheArch {
+			if err := p.validateCacheArch(ctx, ui, comm); err != nil {
+				return err
+			}
+		}
+
+		err := p.uploadDir(ui, comm, p.archivesDir(), p.cacheDir, []string{"lock", "partial"})
 		if err != nil {
 			return err
 		}
+
+		if p.config.SanitizeGuestCache.True() {
+			if err := runRemoteCommand(ctx, ui, comm, fmt.Sprintf("/bin/rm -rf %[1]s/lock %[1]s/partial/*", p.archivesDir())); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func (p *Provisioner) uploadHostPackageTrust(ui packer.Ui, comm packer.Communicator) error {
-	for _, key := range p.config.Keys {
-		f, err := os.Open(key)
-		if os.IsNotExist(err) {
-			ui.Say(fmt.Sprintf("Package trust key '%s' doesn't exist, likely not running on a debian based host. Skipping transfer.", key))
-			continue
-		} else if err != nil {
+func (p *Provisioner) uploadHostPackageTrust(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if p.config.DualKeyInstall && len(p.config.Keys) != 0 {
+		if err := runRemoteCommand(ctx, ui, comm, "/bin/mkdir -p -m 0755 "+keyringsDir); err != nil {
 			return err
 		}
-		defer f.Close()
+	}
 
-		fi, err := f.Stat()
+	// Keys are installed under distinct names, so their order doesn't matter.
+	ui = &lockedUi{Ui: ui}
+	return runConcurrently(ctx, p.config.UploadConcurrency, p.config.Keys, func(ctx context.Context, key string) error {
+		if isKeyURL(key) {
+			return p.uploadKeyURL(ctx, ui, comm, key)
+		}
+		return p.uploadHostKey(ctx, ui, comm, key)
+	})
+}
 
-		if os.IsNotExist(err) {
-			ui.Say(fmt.Sprintf("Package trust key '%s' doesn't exist, likely not running on a debian based host. Skipping transfer.", key))
-			continue
-		} else if err != nil {
+// uploadHostKey installs a key file from the host, closing it once it has
+// been read.
+func (p *Provisioner) uploadHostKey(ctx context.Context, ui packer.Ui, comm packer.Communicator, key string) error {
+	f, err := os.Open(key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	if err := p.installKey(ctx, ui, comm, keyFileName(key), data); err != nil {
+		ui.Error(fmt.Sprintf("Failed to upload APT key %s", key))
+		return err
+	}
+	return nil
+}
+
+func (p *Provisioner) uploadPackageList(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if err := runRemoteCommand(ctx, ui, comm, fmt.Sprintf("/bin/mkdir -p '%s'", p.config.SourcesListDir)); err != nil {
+		return err
+	}
+
+	if len(p.config.Sources) != 0 {
+		sources := p.config.Sources
+		if p.config.IncludeSourceRepos {
+			sources = withSourceRepos(sources)
+		}
+		r := strings.NewReader(strings.Join(sources, "\n") + "\n")
+		err := comm.Upload(path.Join(p.config.SourcesListDir, p.config.SourcesFilename), r, nil)
+		if err != nil {
 			return err
 		}
-
-		err = comm.Upload("/etc/apt/trusted.gpg.d/"+filepath.Base(key), f, &fi)
+	}
+	if len(p.config.Deb822Sources) != 0 {
+		r := strings.NewReader(renderDeb822Sources(p.config.Deb822Sources))
+		err := comm.Upload(path.Join(p.config.SourcesListDir, p.config.deb822FileName()), r, nil)
 		if err != nil {
-			ui.Error(fmt.Sprintf("Failed to upload APT key %s", key))
 			return err
 		}
 	}
 	return nil
 }
 
-func (p *Provisioner) uploadPackageList(ui packer.Ui, comm packer.Communicator) error {
-	r := strings.NewReader(strings.Join(p.config.Sources, "\n") + "\n")
-	err := comm.Upload("/etc/apt/sources.list.d/packer.list", r, nil)
+func (p *Provisioner) updateRemotePackageIndex(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	update := func() (string, int, error) { return p.runUpdate(ctx, ui, comm) }
+	missingKeys := func(output string) bool {
+		return p.config.AutoFetchMissingKeys && len(parseMissingKeys(output)) != 0
+	}
+	rotatedKeys := func(output string) bool {
+		_, failed := parseSignatureErrors(output)
+		return p.config.AutoHandleKeyRotation && failed
+	}
+	permanent := func(output string) bool { return missingKeys(output) || rotatedKeys(output) }
+	output, status, attempts, err := p.retryRemote(ctx, ui, "apt-get update", permanent, update)
 	if err != nil {
 		return err
 	}
+
+	if missingKeys(output) {
+		if err := p.recvRemoteKeys(ctx, ui, comm, parseMissingKeys(output)); err != nil {
+			return err
+		}
+		if output, status, attempts, err = p.retryRemote(ctx, ui, "apt-get update", rotatedKeys, update); err != nil {
+			return err
+		}
+	}
+	if status != 0 && rotatedKeys(output) {
+		ids, _ := parseSignatureErrors(output)
+		if err := p.refreshRotatedKeys(ctx, ui, comm, ids); err != nil {
+			return err
+		}
+		if output, status, attempts, err = p.retryRemote(ctx, ui, "apt-get update", nil, update); err != nil {
+			return err
+		}
+	}
+	if status != 0 {
+		return withAttempts(fmt.Errorf("apt-get update exited with status %d", status), attempts)
+	}
+	// apt only warns about an expired or revoked key when the repository
+	// is still usable.
+	if _, failed := parseSignatureErrors(output); failed {
+		return p.softFail(ui, "apt-get update couldn't verify the signatures of some repositories, see the output above")
+	}
 	return nil
 }
 
-func (p *Provisioner) updateRemotePackageIndex(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
-	cmd := &packer.RemoteCmd{Command: "/usr/bin/apt-get update"}
-	err := cmd.RunWithUi(ctx, comm, ui)
+// runUpdate runs apt-get update and returns its combined output and exit
+// status. With save_update_output, the output of every run is appended to
+// that file as the UI received it.
+func (p *Provisioner) runUpdate(ctx context.Context, ui packer.Ui, comm packer.Communicator) (string, int, error) {
+	if err := p.injectFailure("update"); err != nil {
+		return "", 0, err
+	}
+	if p.config.SaveUpdateOutput != "" {
+		ui = &transcriptUi{Ui: ui, transcript: &p.updateTranscript}
+	}
+	var output syncBuffer
+	cmd := &packer.RemoteCmd{
+		Command: p.aptCommand(nil, p.frontendCommand(p.updateSubcommand())),
+		Stdout:  &output,
+		Stderr:  &output,
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return "", 0, err
+	}
+	if p.config.SaveUpdateOutput != "" && !p.config.Explain {
+		if err := ioutil.WriteFile(p.config.SaveUpdateOutput, []byte(p.updateTranscript.String()), 0644); err != nil {
+			return "", 0, err
+		}
+	}
+	return output.String(), cmd.ExitStatus(), nil
+}
+
+func (p *Provisioner) processRemoteTriggers(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	return runRemoteCommand(ctx, ui, comm, p.aptCommand(noninteractive, "/usr/bin/dpkg --configure --pending"))
+}
+
+func (p *Provisioner) installRemotePackages(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	packages := p.config.Packages
+	if p.config.SkipNewerInstalled {
+		var err error
+		if packages, err = p.skipNewerInstalled(ctx, ui, comm, packages); err != nil {
+			return err
+		}
+	}
+
+	if p.config.PerPackageTimeout != 0 {
+		return p.installRemotePackagesEach(ctx, ui, comm, packages)
+	}
+
+	output, status, attempts, err := p.retryInstall(ctx, ui, comm, packages)
 	if err != nil {
 		return err
 	}
+	if status != 0 && hasUnmetDependencies(output) {
+		return p.resolveUnmet(ctx, ui, comm, output, packages)
+	}
+	return withAttempts(p.checkInstall(ui, output, status), attempts)
+}
+
+// retryInstall installs packages, retrying failures other than unmet
+// dependencies and packages that failed to unpack or configure.
+func (p *Provisioner) retryInstall(ctx context.Context, ui packer.Ui, comm packer.Communicator, packages []string) (string, int, int, error) {
+	permanent := func(output string) bool {
+		return hasUnmetDependencies(output) || len(failedPackages(output)) != 0
+	}
+	return p.retryRemote(ctx, ui, "apt-get install", permanent, func() (string, int, error) {
+		return p.runInstall(ctx, ui, comm, "", packages)
+	})
+}
+
+// withAttempts adds the number of attempts to the error of a retried
+// command.
+func withAttempts(err error, attempts int) error {
+	if err == nil || attempts < 2 {
+		return err
+	}
+	return fmt.Errorf("%v after %d attempts", err, attempts)
+}
+
+// installRemotePackagesEach installs the packages one at a time, each with
+// its own timeout.
+func (p *Provisioner) installRemotePackagesEach(ctx context.Context, ui packer.Ui, comm packer.Communicator, packages []string) error {
+	var timedOut []string
+	for _, pkg := range packages {
+		pkgCtx, cancel := context.WithTimeout(ctx, p.config.PerPackageTimeout)
+		output, status, attempts, err := p.retryInstall(pkgCtx, ui, comm, []string{pkg})
+		cancel()
+		if err == nil {
+			if err := withAttempts(p.checkInstall(ui, output, status), attempts); err != nil {
+				return err
+			}
+			continue
+		}
+		if pkgCtx.Err() != context.DeadlineExceeded || ctx.Err() != nil {
+			return err
+		}
+		if !p.config.SkipOnTimeout {
+			return fmt.Errorf("installing %s timed out after %s", pkg, p.config.PerPackageTimeout)
+		}
+		ui.Error(fmt.Sprintf("Installing %s timed out after %s, skipping", pkg, p.config.PerPackageTimeout))
+		timedOut = append(timedOut, pkg)
+	}
+	if len(timedOut) != 0 {
+		ui.Error(fmt.Sprintf("Packages not installed because of timeouts: %s", strings.Join(timedOut, " ")))
+	}
 	return nil
 }
 
-func (p *Provisioner) installRemotePackages(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+// installOptions adds the configured apt-get install options to options.
+func (p *Provisioner) installOptions(options string) string {
+	options = p.solverOptions() + p.forceYesOptions() + options
+	if len(p.config.ExtraArguments) != 0 {
+		options += strings.Join(p.config.ExtraArguments, " ") + " "
+	}
+	if !p.config.InstallRecommends {
+		options = "--no-install-recommends " + options
+	}
+	return options
+}
+
+// runInstall runs apt-get install with extra options, returning the combined
+// output and the exit status of the command.
+func (p *Provisioner) runInstall(ctx context.Context, ui packer.Ui, comm packer.Communicator, options string, packages []string) (string, int, error) {
+	if err := p.injectFailure("install"); err != nil {
+		return "", 0, err
+	}
+	options = p.installOptions(options)
+	options = p.simulateOption() + options
+	cmdUi := ui
+	if p.config.ProgressFd {
+		options = "-o APT::Status-Fd=1 " + options
+		cmdUi = newStatusUi(ui)
+	}
+	var command string
+	if p.config.InstallFromFile {
+		var err error
+		if command, err = p.installFromFileCommand(comm, options, packages); err != nil {
+			return "", 0, err
+		}
+		ui.Say(fmt.Sprintf("Installing the %d packages listed in %s", len(packages), remoteInstallList))
+	} else {
+		command = p.aptCommand(noninteractive, fmt.Sprintf(
+			"%s -y %s%s",
+			p.frontendCommand("install"),
+			options,
+			strings.Join(packages, " "),
+		))
+	}
+	ui.Say(fmt.Sprintf("Running %s", command))
+
+	var output syncBuffer
 	cmd := &packer.RemoteCmd{
-		Command: fmt.Sprintf(
-			"DEBIAN_FRONTEND=noninteractive /usr/bin/apt-get install -y --no-install-recommends %s",
-			strings.Join(p.config.Packages, " "),
-		),
+		Command: command,
+		Stdout:  &output,
+		Stderr:  &output,
+	}
+	if err := cmd.RunWithUi(ctx, comm, cmdUi); err != nil {
+		return "", 0, err
+	}
+	return output.String(), cmd.ExitStatus(), nil
+}
+
+// removeRemotePackages runs apt-get remove or apt-get purge on packages.
+func (p *Provisioner) removeRemotePackages(ctx context.Context, ui packer.Ui, comm packer.Communicator, action string, packages []string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+	if err := p.checkRemovals(ctx, ui, comm, action, packages); err != nil {
+		return err
+	}
+	if p.config.DryRun {
+		ui.Say(fmt.Sprintf("Dry run, skipping apt-get %s %s", action, strings.Join(packages, " ")))
+		return nil
+	}
+	options := p.forceYesOptions()
+	if p.config.AllowEssentialRemoval && !p.config.ForceYes {
+		options = "--allow-remove-essential "
+	}
+	cmd := &packer.RemoteCmd{
+		Command: p.aptCommand(noninteractive, fmt.Sprintf(
+			"/usr/bin/apt-get %s -y %s%s",
+			action,
+			options,
+			strings.Join(packages, " "),
+		)),
 	}
 	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
 		return err
 	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("apt-get %s of %s failed with exit status %d", action, strings.Join(packages, " "), status)
+	}
+	return nil
+}
+
+func (p *Provisioner) manageRemoteServices(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	actions := []struct {
+		verb  string
+		units []string
+	}{
+		{"enable", p.config.EnableServices},
+		{"disable", p.config.DisableServices},
+		{"mask", p.config.MaskServices},
+	}
+	for _, action := range actions {
+		for _, unit := range action.units {
+			if p.config.DryRun {
+				ui.Say(fmt.Sprintf("Dry run, skipping systemctl %s %s", action.verb, unit))
+				continue
+			}
+			if err := runRemoteCommand(ctx, ui, comm, fmt.Sprintf("/bin/systemctl %s '%s'", action.verb, unit)); err != nil {
+				return fmt.Errorf("failed to %s %s: %v", action.verb, unit, err)
+			}
+		}
+	}
 	return nil
 }
 
+// dnsTestScript retries check until it succeeds, for up to 10 seconds.
+const dnsTestScript = `for i in $(seq 100); do
+	if %s; then
+		exit 0
+	fi
+	sleep 0.1
+done
+exit 1`
+
+// resolveCheck resolves a host with whichever resolver tool the guest has:
+// resolvectl on systemd-resolved hosts, otherwise getent or nslookup.
+const resolveCheck = "{ resolvectl query %[1]s || getent hosts %[1]s || nslookup %[1]s; } >/dev/null 2>&1"
+
+// testRemoteDNS waits for any of the DNS probe hosts to resolve, or for
+// dns_test_command to succeed.
 func (p *Provisioner) testRemoteDNS(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var checks []string
+	for _, host := range p.config.DNSProbeHost {
+		checks = append(checks, fmt.Sprintf(resolveCheck, host))
+	}
+	check := strings.Join(checks, " || ")
+	if p.config.DNSTestCommand != "" {
+		check = "{ " + p.config.DNSTestCommand + "\n}"
+	}
+
 	cmd := &packer.RemoteCmd{
-		Command: "/bin/sh -c 'for i in $(seq 100); do " +
-			"resolvectl query deb.debian.org >/dev/null && break; sleep 0.1; done; " +
-			"resolvectl query deb.debian.org'",
+		Command: "/bin/sh",
+		Stdin:   strings.NewReader(fmt.Sprintf(dnsTestScript, check)),
 	}
 	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
 		return err
 	}
+	if cmd.ExitStatus() != 0 {
+		if p.config.DNSTestCommand != "" {
+			return fmt.Errorf("dns_test_command kept failing: %s", p.config.DNSTestCommand)
+		}
+		return fmt.Errorf("none of the DNS probe hosts resolved: %s", strings.Join(p.config.DNSProbeHost, ", "))
+	}
 	return nil
 }
 
 func (p *Provisioner) cleanRemotePackages(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
-	cmd := &packer.RemoteCmd{Command: "/usr/bin/apt-get clean"}
+	cmd := &packer.RemoteCmd{Command: p.aptCommand(nil, "/usr/bin/apt-get clean")}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("exit status %d", status)
+	}
+	return nil
+}
+
+func (p *Provisioner) autoremoveRemotePackages(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	cmd := &packer.RemoteCmd{Command: p.aptCommand(noninteractive, "/usr/bin/apt-get autoremove -y --purge")}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("apt-get autoremove failed with exit status %d", status)
+	}
+	return nil
+}
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of a remote
+// command's stdout and stderr.
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(data)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+var noninteractive = []string{"DEBIAN_FRONTEND=noninteractive"}
+
+// overrideEnv returns the assignments of env with those of vars replacing
+// the ones of the same variable. The values of vars are quoted for the
+// shell.
+func overrideEnv(env []string, vars []string) []string {
+	if len(vars) == 0 {
+		return env
+	}
+	overridden := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		overridden[strings.SplitN(v, "=", 2)[0]] = true
+	}
+	var merged []string
+	for _, v := range env {
+		if !overridden[strings.SplitN(v, "=", 2)[0]] {
+			merged = append(merged, v)
+		}
+	}
+	for _, v := range vars {
+		parts := strings.SplitN(v, "=", 2)
+		merged = append(merged, parts[0]+"="+shellQuote(parts[1]))
+	}
+	return merged
+}
+
+// aptCommand builds the command line of an apt or dpkg invocation. The
+// configured command prefix wraps the whole invocation, so environment
+// assignments are passed through env(1) when a prefix is set. A configured
+// umask is set in the shell running the invocation.
+func (p *Provisioner) aptCommand(env []string, command string) string {
+	if locale := p.config.aptLocale(); locale != "" {
+		env = append([]string{"LC_ALL=" + locale}, env...)
+	}
+	env = overrideEnv(env, p.config.EnvironmentVars)
+
+	var parts []string
+	if p.config.Umask != "" {
+		parts = append(parts, "umask", p.config.Umask, "&&")
+	}
+	if p.config.CommandPrefix != "" {
+		parts = append(parts, p.config.CommandPrefix)
+		if len(env) != 0 {
+			parts = append(parts, "/usr/bin/env")
+		}
+	}
+	parts = append(parts, env...)
+	parts = append(parts, command)
+	return strings.Join(parts, " ")
+}
+
+// runRemoteCommand runs command with its output shown on ui, failing with the
+// end of the output when it exits with a non-zero status.
+func runRemoteCommand(ctx context.Context, ui packer.Ui, comm packer.Communicator, command string) error {
+	var output syncBuffer
+	cmd := &packer.RemoteCmd{
+		Command: command,
+		Stdout:  &output,
+		Stderr:  &output,
+	}
 	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
 		return err
 	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("%s exited with status %d: %s", command, status, outputTail(output.String()))
+	}
 	return nil
 }
+
+// outputTail returns the last lines of a command's output, which is where
+// apt and dpkg put the reason they failed.
+func outputTail(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > 10 {
+		lines = lines[len(lines)-10:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runRemoteOutput runs command on the guest and returns its standard output
+// without echoing it to the UI.
+func runRemoteOutput(ctx context.Context, comm packer.Communicator, command string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: command,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return "", err
+	}
+	if status := cmd.Wait(); status != 0 {
+		return "", fmt.Errorf("%s: exit status %d: %s", command, status, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
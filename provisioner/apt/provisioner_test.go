@@ -0,0 +1,455 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// fakeComm records the commands run and the files transferred. Commands
+// succeed with no output unless status or output say otherwise, and
+// downloads return the files in downloads.
+type fakeComm struct {
+	mu         sync.Mutex
+	commands   []string
+	uploads    map[string]string
+	downloads  map[string][]byte
+	downloaded []string
+
+	status func(command string) int
+	output func(command string) string
+}
+
+func (c *fakeComm) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	c.mu.Lock()
+	c.commands = append(c.commands, cmd.Command)
+	c.mu.Unlock()
+
+	status := 0
+	if c.status != nil {
+		status = c.status(cmd.Command)
+	}
+	var output string
+	if c.output != nil {
+		output = c.output(cmd.Command)
+	}
+	go func() {
+		if cmd.Stdin != nil {
+			_, _ = io.Copy(ioutil.Discard, cmd.Stdin)
+		}
+		if output != "" && cmd.Stdout != nil {
+			_, _ = io.Copy(cmd.Stdout, strings.NewReader(output))
+		}
+		cmd.SetExited(status)
+	}()
+	return nil
+}
+
+func (c *fakeComm) Upload(dst string, r io.Reader, _ *os.FileInfo) error {
+	var data bytes.Buffer
+	if _, err := io.Copy(&data, r); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.uploads == nil {
+		c.uploads = make(map[string]string)
+	}
+	c.uploads[dst] = data.String()
+	return nil
+}
+
+func (c *fakeComm) UploadDir(dst string, src string, exclude []string) error {
+	return nil
+}
+
+func (c *fakeComm) Download(src string, w io.Writer) error {
+	c.mu.Lock()
+	c.downloaded = append(c.downloaded, src)
+	c.mu.Unlock()
+	_, err := w.Write(c.downloads[src])
+	return err
+}
+
+func (c *fakeComm) DownloadDir(src string, dst string, exclude []string) error {
+	return nil
+}
+
+// failing returns a status func that fails the commands containing any of
+// substrs. Empty substrs fail nothing.
+func failing(substrs ...string) func(string) int {
+	return func(command string) int {
+		for _, s := range substrs {
+			if s != "" && strings.Contains(command, s) {
+				return 1
+			}
+		}
+		return 0
+	}
+}
+
+func TestRunRemoteCommand(t *testing.T) {
+	comm := &fakeComm{
+		status: failing("false"),
+		output: func(string) string { return "E: Unable to locate package nope\n" },
+	}
+	ui := packer.TestUi(t)
+
+	if err := runRemoteCommand(context.Background(), ui, comm, "/bin/true"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := runRemoteCommand(context.Background(), ui, comm, "/bin/false")
+	if err == nil {
+		t.Fatal("expected an error for a non-zero exit status")
+	}
+	for _, want := range []string{"/bin/false", "status 1", "Unable to locate package nope"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't contain %q", err, want)
+		}
+	}
+}
+
+func TestManageRemoteServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		fail     string
+		commands []string
+		err      string
+	}{
+		{
+			name: "every action",
+			config: Config{
+				EnableServices:  []string{"nginx.service", "ssh.service"},
+				DisableServices: []string{"apache2.service"},
+				MaskServices:    []string{"apt-daily.timer"},
+			},
+			commands: []string{
+				"/bin/systemctl enable 'nginx.service'",
+				"/bin/systemctl enable 'ssh.service'",
+				"/bin/systemctl disable 'apache2.service'",
+				"/bin/systemctl mask 'apt-daily.timer'",
+			},
+		},
+		{
+			name:   "missing unit",
+			config: Config{EnableServices: []string{"nginx.service", "missing.service", "ssh.service"}},
+			fail:   "missing.service",
+			commands: []string{
+				"/bin/systemctl enable 'nginx.service'",
+				"/bin/systemctl enable 'missing.service'",
+			},
+			err: "failed to enable missing.service",
+		},
+		{
+			name:   "nothing to do",
+			config: Config{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm := &fakeComm{status: failing(tt.fail)}
+			p := &Provisioner{config: tt.config}
+
+			err := p.manageRemoteServices(context.Background(), packer.TestUi(t), comm)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+			if strings.Join(comm.commands, "\n") != strings.Join(tt.commands, "\n") {
+				t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(comm.commands, "\n"), strings.Join(tt.commands, "\n"))
+			}
+		})
+	}
+}
+
+func TestProcessRemoteTriggers(t *testing.T) {
+	for _, status := range []int{0, 1} {
+		comm := &fakeComm{status: func(string) int { return status }}
+		p := &Provisioner{}
+
+		err := p.processRemoteTriggers(context.Background(), packer.TestUi(t), comm)
+		if (err != nil) != (status != 0) {
+			t.Errorf("exit status %d: got error %v", status, err)
+		}
+		if len(comm.commands) != 1 || !strings.Contains(comm.commands[0], "/usr/bin/dpkg --configure --pending") {
+			t.Errorf("exit status %d: unexpected commands %q", status, comm.commands)
+		}
+	}
+}
+
+// writeFiles creates the named files with their contents in dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCacheDelta(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"curl_7.88.1-10_amd64.deb":     "cached",
+		"git_1%3a2.39.2-1.1_amd64.deb": "cached",
+	})
+
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{name: "nothing new", names: []string{"curl_7.88.1-10_amd64.deb"}},
+		{
+			name:  "new packages only",
+			names: []string{"curl_7.88.1-10_amd64.deb", "nginx_1.22.1-9_amd64.deb", "git_1%3a2.39.2-1.1_amd64.deb", "vim_2%3a9.0.1378-2_amd64.deb"},
+			want:  []string{"nginx_1.22.1-9_amd64.deb", "vim_2%3a9.0.1378-2_amd64.deb"},
+		},
+		{
+			name:  "lock and partial are skipped",
+			names: []string{"lock", "partial", "nginx_1.22.1-9_amd64.deb"},
+			want:  []string{"nginx_1.22.1-9_amd64.deb"},
+		},
+		{name: "empty guest cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cacheDelta(dir, tt.names)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateCacheDownloadsOnlyNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"curl_7.88.1-10_amd64.deb": "cached"})
+	comm := &fakeComm{
+		output: func(command string) string {
+			if command == "/bin/ls -1 "+remoteArchivesDir {
+				return "curl_7.88.1-10_amd64.deb\nlock\nnginx_1.22.1-9_amd64.deb\npartial\n"
+			}
+			return ""
+		},
+		downloads: map[string][]byte{remoteArchivesDir + "/nginx_1.22.1-9_amd64.deb": []byte("nginx")},
+	}
+	p := &Provisioner{cacheDir: dir}
+
+	if err := p.updateCache(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{remoteArchivesDir + "/nginx_1.22.1-9_amd64.deb"}; strings.Join(comm.downloaded, " ") != strings.Join(want, " ") {
+		t.Errorf("downloaded %q, want %q", comm.downloaded, want)
+	}
+	for name, want := range map[string]string{"curl_7.88.1-10_amd64.deb": "cached", "nginx_1.22.1-9_amd64.deb": "nginx"} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v, want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestAptCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		env    []string
+		want   string
+	}{
+		{name: "plain", want: "/usr/bin/apt-get update"},
+		{name: "environment", env: noninteractive, want: "DEBIAN_FRONTEND=noninteractive /usr/bin/apt-get update"},
+		{
+			name:   "prefix without environment",
+			config: Config{CommandPrefix: "nice -n 19"},
+			want:   "nice -n 19 /usr/bin/apt-get update",
+		},
+		{
+			name:   "prefix passes the environment through env",
+			config: Config{CommandPrefix: "ionice -c3", AptLocale: "C.UTF-8"},
+			env:    noninteractive,
+			want:   "ionice -c3 /usr/bin/env LC_ALL=C.UTF-8 DEBIAN_FRONTEND=noninteractive /usr/bin/apt-get update",
+		},
+		{
+			name:   "umask runs before the prefix",
+			config: Config{CommandPrefix: "nice", Umask: "027", EnvironmentVars: []string{"DEBIAN_FRONTEND=readline"}},
+			env:    noninteractive,
+			want:   "umask 027 && nice /usr/bin/env DEBIAN_FRONTEND='readline' /usr/bin/apt-get update",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provisioner{config: tt.config}
+			if got := p.aptCommand(tt.env, "/usr/bin/apt-get update"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCommandPrefixAppliedEverywhere runs a provisioning touching most steps
+// and checks that every apt, dpkg and user command carries command_prefix.
+func TestCommandPrefixAppliedEverywhere(t *testing.T) {
+	p, errs := prepare(t, map[string]interface{}{
+		"packages":         []string{"curl", "nginx"},
+		"remove":           []string{"nano"},
+		"purge":            []string{"vim-tiny"},
+		"hold":             []string{"linux-image-amd64"},
+		"upgrade":          "full",
+		"autoremove":       true,
+		"fix_broken":       true,
+		"process_triggers": true,
+		"remove_orphans":   true,
+		"pre_commands":     []string{"true"},
+		"post_commands":    []string{"true"},
+		"command_prefix":   "nice -n 19",
+		"environment_vars": []string{"APT_LISTCHANGES_FRONTEND=none"},
+	})
+	if errs != "" {
+		t.Fatal(errs)
+	}
+	comm := &fakeComm{output: func(command string) string {
+		if strings.HasPrefix(command, "/usr/bin/dpkg-query") && strings.Contains(command, "linux-image-amd64") {
+			return "ii  linux-image-amd64 6.1.76-1\n"
+		}
+		return ""
+	}}
+	if err := p.Provision(context.Background(), packer.TestUi(t), comm, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	all := strings.Join(comm.commands, "\n")
+	for _, want := range []string{"/usr/bin/apt-get update", "/usr/bin/dpkg --configure -a", "/usr/bin/apt-get dist-upgrade -y",
+		"/usr/bin/apt-mark hold linux-image-amd64", "/usr/bin/apt-get autoremove -y --purge"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("no %q in commands:\n%s", want, all)
+		}
+	}
+	var checked int
+	for _, command := range comm.commands {
+		if !strings.Contains(command, "/usr/bin/apt-get ") && !strings.Contains(command, "/usr/bin/apt-mark ") &&
+			!strings.Contains(command, "/usr/bin/dpkg ") && !strings.Contains(command, "/bin/sh -c 'true'") {
+			continue
+		}
+		checked++
+		if !strings.HasPrefix(command, "nice -n 19 /usr/bin/env ") {
+			t.Errorf("command without command_prefix: %s", command)
+		}
+	}
+	if checked < 10 {
+		t.Errorf("only %d prefixed commands checked:\n%s", checked, all)
+	}
+}
+
+func TestStrictSoftFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		run  func(t *testing.T, p *Provisioner, ui packer.Ui) error
+	}{
+		{
+			name: "missing cache_dir on upload",
+			msg:  "Host APT package cache not found",
+			run: func(t *testing.T, p *Provisioner, ui packer.Ui) error {
+				p.cacheDir = filepath.Join(t.TempDir(), "missing")
+				return p.uploadHostPackageCache(context.Background(), ui, &fakeComm{})
+			},
+		},
+		{
+			name: "missing cache_dir on write-back",
+			msg:  "Skipping updating package cache",
+			run: func(t *testing.T, p *Provisioner, ui packer.Ui) error {
+				p.cacheDir = filepath.Join(t.TempDir(), "missing")
+				return p.updateCache(context.Background(), ui, &fakeComm{})
+			},
+		},
+		{
+			name: "failed apt-get clean",
+			msg:  "apt-get clean failed",
+			run: func(t *testing.T, p *Provisioner, ui packer.Ui) error {
+				strict := p.config.Strict
+				if err := p.Prepare(map[string]interface{}{"packages": []string{"curl"}, "cache_dir": t.TempDir(), "strict": strict}); err != nil {
+					t.Fatal(err)
+				}
+				return p.Provision(context.Background(), ui, &fakeComm{status: failing("/usr/bin/apt-get clean")}, nil)
+			},
+		},
+		{
+			name: "foreign packages in cache_dir",
+			msg:  "has 1 packages not built for amd64",
+			run: func(t *testing.T, p *Provisioner, ui packer.Ui) error {
+				p.cacheDir = t.TempDir()
+				writeFiles(t, p.cacheDir, map[string]string{"curl_7.88.1-10_amd64.deb": "", "curl_7.88.1-10_arm64.deb": ""})
+				p.facts = &guestFacts{ID: "debian", Codename: "bookworm", Arch: "amd64"}
+				return p.validateCacheArch(context.Background(), ui, &fakeComm{})
+			},
+		},
+		{
+			name: "failed fstrim",
+			msg:  "fstrim exited with status 1",
+			run: func(t *testing.T, p *Provisioner, ui packer.Ui) error {
+				return p.trimRemoteFreeSpace(context.Background(), ui, &fakeComm{status: failing("fstrim")})
+			},
+		},
+		{
+			name: "expired repository key",
+			msg:  "couldn't verify the signatures of some repositories",
+			run: func(t *testing.T, p *Provisioner, ui packer.Ui) error {
+				comm := &fakeComm{output: func(string) string {
+					return "W: GPG error: https://example.com/debian stable InRelease: The following signatures were invalid: " +
+						"EXPKEYSIG 0123456789ABCDEF Example <repo@example.com>\n"
+				}}
+				return p.updateRemotePackageIndex(context.Background(), ui, comm)
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, strict := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/strict=%v", tt.name, strict), func(t *testing.T) {
+				ui := &recordingUi{Ui: packer.TestUi(t)}
+				p := &Provisioner{config: Config{Strict: strict}}
+
+				err := tt.run(t, p, ui)
+				if strict {
+					if err == nil || !strings.Contains(err.Error(), tt.msg) {
+						t.Fatalf("expected error containing %q, got %v", tt.msg, err)
+					}
+					if !containsSubstring(ui.errors, tt.msg) {
+						t.Errorf("%q not reported as an error: %q", tt.msg, ui.errors)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !containsSubstring(ui.said, tt.msg) || !containsSubstring(ui.said, ", ignoring") {
+					t.Errorf("%q not reported as ignored: %q", tt.msg, ui.said)
+				}
+			})
+		}
+	}
+}
+
+// containsSubstring reports whether any of msgs contains substr.
+func containsSubstring(msgs []string, substr string) bool {
+	for _, msg := range msgs {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package apt
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var binfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+
+// hostQemuArchs maps GOARCH to the architecture names qemu-user uses for its
+// binfmt_misc handlers.
+var hostQemuArchs = map[string]string{
+	"386":     "i386",
+	"amd64":   "x86_64",
+	"arm":     "arm",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// elfQemuArch returns the qemu-user architecture of an ELF binary.
+func elfQemuArch(data []byte) (string, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	switch f.Machine {
+	case elf.EM_386:
+		return "i386", nil
+	case elf.EM_X86_64:
+		return "x86_64", nil
+	case elf.EM_ARM:
+		return "arm", nil
+	case elf.EM_AARCH64:
+		return "aarch64", nil
+	case elf.EM_PPC64:
+		if f.ByteOrder == binary.LittleEndian {
+			return "ppc64le", nil
+		}
+		return "ppc64", nil
+	case elf.EM_RISCV:
+		return "riscv64", nil
+	case elf.EM_S390:
+		return "s390x", nil
+	}
+	return "", fmt.Errorf("unsupported ELF machine %s", f.Machine)
+}
+
+// binfmtRegistered reports whether the qemu-user handler for arch is
+// registered and enabled with the host kernel.
+func binfmtRegistered(arch string) bool {
+	data, err := ioutil.ReadFile(binfmtMiscDir + "/qemu-" + arch)
+	return err == nil && strings.HasPrefix(string(data), "enabled")
+}
+
+// ensureQemuUserStatic makes sure the host can run the binaries of a
+// foreign-architecture guest. The guest architecture is read from the ELF
+// header of its /bin/sh, because no guest binary can run before emulation
+// is set up. When the handler is missing, the build fails with instructions,
+// unless install_qemu_user_static allows installing qemu-user-static on the
+// host, which registers it.
+func (p *Provisioner) ensureQemuUserStatic(ui packer.Ui, comm packer.Communicator) error {
+	var sh bytes.Buffer
+	if err := comm.Download("/bin/sh", &sh); err != nil {
+		return err
+	}
+	if p.config.Explain {
+		return nil
+	}
+	guest, err := elfQemuArch(sh.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to detect the guest architecture: %v", err)
+	}
+	if host, ok := hostQemuArchs[runtime.GOARCH]; ok && host == guest {
+		return nil
+	}
+
+	if binfmtRegistered(guest) {
+		ui.Say(fmt.Sprintf("Using the registered qemu-%s handler for the %s guest", guest, guest))
+		return nil
+	}
+
+	if !p.config.InstallQemuUserStatic {
+		return fmt.Errorf("no qemu-%[1]s binfmt_misc handler is registered on the host to run the %[1]s guest: "+
+			"install qemu-user-static on the host, e.g. with apt-get install qemu-user-static, "+
+			"or set install_qemu_user_static to let the provisioner install it", guest)
+	}
+
+	ui.Say(fmt.Sprintf("No qemu-%s handler registered, installing qemu-user-static on the host", guest))
+	cmd := exec.Command("/usr/bin/apt-get", "install", "-y", "qemu-user-static")
+	cmd.Env = append(os.Environ(), noninteractive...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to install qemu-user-static: %v: %s", err, output)
+	}
+	if !binfmtRegistered(guest) {
+		return fmt.Errorf("qemu-user-static is installed, but no qemu-%s handler is registered", guest)
+	}
+	return nil
+}
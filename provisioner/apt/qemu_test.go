@@ -0,0 +1,102 @@
+package apt
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// elfHeader returns a little-endian ELF64 header for machine.
+func elfHeader(t *testing.T, machine elf.Machine) []byte {
+	t.Helper()
+	h := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    64,
+		Phentsize: 56,
+		Shentsize: 64,
+	}
+	copy(h.Ident[:], elf.ELFMAG)
+	h.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	h.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	h.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, h); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestElfQemuArch(t *testing.T) {
+	for machine, want := range map[elf.Machine]string{
+		elf.EM_X86_64:  "x86_64",
+		elf.EM_AARCH64: "aarch64",
+		elf.EM_RISCV:   "riscv64",
+		elf.EM_PPC64:   "ppc64le",
+	} {
+		got, err := elfQemuArch(elfHeader(t, machine))
+		if err != nil || got != want {
+			t.Errorf("%s: got %q, %v, want %q", machine, got, err, want)
+		}
+	}
+	if _, err := elfQemuArch([]byte("#!/bin/sh\n")); err == nil {
+		t.Error("expected an error for a non-ELF file")
+	}
+}
+
+func TestEnsureQemuUserStatic(t *testing.T) {
+	machine, arch := elf.EM_AARCH64, "aarch64"
+	if runtime.GOARCH == "arm64" {
+		machine, arch = elf.EM_X86_64, "x86_64"
+	}
+
+	tests := []struct {
+		name       string
+		registered string
+		err        string
+	}{
+		{name: "registered handler", registered: "enabled\ninterpreter /usr/libexec/qemu-binfmt/" + arch + "-binfmt-P\n"},
+		{name: "disabled handler", registered: "disabled\n", err: "install qemu-user-static on the host"},
+		{name: "no handler", err: "no qemu-" + arch + " binfmt_misc handler is registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			defer func(dir string) { binfmtMiscDir = dir }(binfmtMiscDir)
+			binfmtMiscDir = dir
+			if tt.registered != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, "qemu-"+arch), []byte(tt.registered), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			comm := &fakeComm{downloads: map[string][]byte{"/bin/sh": elfHeader(t, machine)}}
+			p := &Provisioner{config: Config{EnsureQemuUserStatic: true}}
+
+			err := p.ensureQemuUserStatic(packer.TestUi(t), comm)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestPrepareInstallQemuUserStatic(t *testing.T) {
+	if _, err := prepare(t, map[string]interface{}{"install_qemu_user_static": true}); !strings.Contains(err, "needs ensure_qemu_user_static") {
+		t.Errorf("unexpected error %q", err)
+	}
+	if _, err := prepare(t, map[string]interface{}{"install_qemu_user_static": true, "ensure_qemu_user_static": true}); err != "" {
+		t.Errorf("unexpected error %q", err)
+	}
+}
@@ -0,0 +1,46 @@
+package apt
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// rawIndexNames are the index file names apt looks for in a flat repository.
+var rawIndexNames = map[string]bool{
+	"Packages":     true,
+	"Packages.gz":  true,
+	"Packages.xz":  true,
+	"Packages.bz2": true,
+}
+
+// source synthesizes a flat repository source for the index. The Filename
+// fields of a Packages index are relative to the base URL, so the index
+// directory becomes the suite, relative to the base URL.
+func (r RawPackageIndex) source() (string, error) {
+	base, err := url.Parse(r.BaseURL)
+	if err != nil || !(base.Scheme == "http" || base.Scheme == "https" || base.Scheme == "file") {
+		return "", fmt.Errorf("base_url must be an http, https or file URL: %q", r.BaseURL)
+	}
+	index, err := url.Parse(r.IndexURL)
+	if err != nil || index.Scheme != base.Scheme || index.Host != base.Host {
+		return "", fmt.Errorf("index_url must be a URL on the host of base_url: %q", r.IndexURL)
+	}
+	if !rawIndexNames[path.Base(index.Path)] {
+		return "", fmt.Errorf("index_url must point to a Packages index: %q", r.IndexURL)
+	}
+
+	basePath := strings.TrimSuffix(base.Path, "/") + "/"
+	dir := path.Dir(index.Path) + "/"
+	if !strings.HasPrefix(dir, basePath) {
+		return "", fmt.Errorf("index_url must be below base_url: %q", r.IndexURL)
+	}
+	suite := "./" + strings.TrimPrefix(dir, basePath)
+
+	options := ""
+	if r.Trusted {
+		options = "[trusted=yes] "
+	}
+	return fmt.Sprintf("deb %s%s %s", options, strings.TrimSuffix(r.BaseURL, "/"), suite), nil
+}
@@ -0,0 +1,91 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+)
+
+const bootIDCommand = "/bin/cat /proc/sys/kernel/random/boot_id"
+
+// systemReady reports whether systemctl is-system-running says the boot has
+// finished. A degraded system has finished booting too, only with failed
+// units.
+func systemReady(state string) bool {
+	state = strings.TrimSpace(state)
+	return state == "running" || state == "degraded"
+}
+
+// rebootIfRequired reboots the guest when a package asked for it through
+// /var/run/reboot-required, then waits for it to come back.
+func (p *Provisioner) rebootIfRequired(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	cmd := &packer.RemoteCmd{Command: "/usr/bin/test -f /var/run/reboot-required"}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if cmd.ExitStatus() != 0 || p.config.Explain {
+		return nil
+	}
+	if p.config.DryRun {
+		ui.Say("Dry run, skipping the reboot packages require")
+		return nil
+	}
+
+	bootID, err := runRemoteOutput(ctx, comm, bootIDCommand)
+	if err != nil {
+		return err
+	}
+	ui.Say("Packages require a reboot, rebooting")
+	// The connection usually drops before the command returns, so its result
+	// says nothing about whether the reboot started.
+	cmd = &packer.RemoteCmd{Command: p.aptCommand(nil, "/sbin/shutdown -r now")}
+	_ = cmd.RunWithUi(ctx, comm, ui)
+
+	return p.waitForReboot(ctx, ui, comm, bootID)
+}
+
+// waitForReboot polls the guest until it reconnects with a new boot ID and
+// systemd reports the boot finished, or reboot_timeout passes.
+func (p *Provisioner) waitForReboot(ctx context.Context, ui packer.Ui, comm packer.Communicator, bootID string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.config.RebootTimeout)
+	defer cancel()
+
+	var lastErr error
+	err := retry.Config{
+		RetryDelay: func() time.Duration { return 5 * time.Second },
+	}.Run(ctx, func(ctx context.Context) error {
+		id, err := runRemoteOutput(ctx, comm, bootIDCommand)
+		if err != nil {
+			lastErr = err
+			return err
+		}
+		if id == bootID {
+			lastErr = fmt.Errorf("still running the boot from before the reboot")
+			return lastErr
+		}
+		// is-system-running exits non-zero unless the system is running, so
+		// its state is read from the output.
+		state, err := runRemoteOutput(ctx, comm, "/bin/systemctl is-system-running || true")
+		if err != nil {
+			lastErr = err
+			return err
+		}
+		if !systemReady(state) {
+			lastErr = fmt.Errorf("system is %s", strings.TrimSpace(state))
+			return lastErr
+		}
+		return nil
+	})
+	if err != nil {
+		if lastErr == nil {
+			lastErr = err
+		}
+		return fmt.Errorf("guest not ready %s after reboot: %v", p.config.RebootTimeout, lastErr)
+	}
+	ui.Say("Guest is back after the reboot")
+	return nil
+}
@@ -0,0 +1,70 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// simulatedRemovals returns the packages a simulated apt-get remove or purge
+// would take out, as reported by its Remv and Purg lines.
+func simulatedRemovals(output string) []string {
+	var removed []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if fields[0] == "Remv" || fields[0] == "Purg" {
+			removed = append(removed, fields[1])
+		}
+	}
+	return removed
+}
+
+// parseEssential returns the packages dpkg-query reported with Essential: yes
+// from package and essential flag pairs.
+func parseEssential(output string) []string {
+	var essential []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "yes" {
+			essential = append(essential, fields[0])
+		}
+	}
+	return essential
+}
+
+// checkRemovals simulates the removal of packages and fails when it would
+// take out more than max_removals packages or, unless allowed, an essential
+// package. Essential packages are those marked so in the dpkg status file.
+func (p *Provisioner) checkRemovals(ctx context.Context, ui packer.Ui, comm packer.Communicator, action string, packages []string) error {
+	output, err := runRemoteOutput(ctx, comm, p.aptCommand(noninteractive, fmt.Sprintf(
+		"/usr/bin/apt-get -s %s --allow-remove-essential %s", action, strings.Join(packages, " "))))
+	if err != nil {
+		return err
+	}
+	removed := simulatedRemovals(output)
+	if len(removed) == 0 {
+		return nil
+	}
+	ui.Say(fmt.Sprintf("apt-get %s would remove %d packages: %s", action, len(removed), strings.Join(removed, " ")))
+
+	if p.config.MaxRemovals > 0 && len(removed) > p.config.MaxRemovals {
+		return fmt.Errorf("apt-get %s would remove %d packages, more than max_removals %d", action, len(removed), p.config.MaxRemovals)
+	}
+	if p.config.AllowEssentialRemoval {
+		return nil
+	}
+	output, err = runRemoteOutput(ctx, comm, fmt.Sprintf(
+		"/usr/bin/dpkg-query -W -f '${binary:Package} ${Essential}\\n' %s", strings.Join(removed, " ")))
+	if err != nil {
+		return err
+	}
+	if essential := parseEssential(output); len(essential) != 0 {
+		return fmt.Errorf("apt-get %s would remove essential packages: %s", action, strings.Join(essential, " "))
+	}
+	return nil
+}
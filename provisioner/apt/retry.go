@@ -0,0 +1,38 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// retryRemote runs a remote command up to retry_tries times while it exits
+// with a non-zero status or fails by injection, waiting retry_delay between
+// attempts. permanent reports failures in the output that another attempt
+// can't fix. It returns the output and status of the last attempt and the
+// number of attempts made.
+func (p *Provisioner) retryRemote(ctx context.Context, ui packer.Ui, name string, permanent func(string) bool,
+	run func() (string, int, error)) (output string, status int, attempts int, err error) {
+	for attempts = 1; ; attempts++ {
+		output, status, err = run()
+		var injected *injectedFailure
+		failed := status != 0 || errors.As(err, &injected)
+		if (err != nil && injected == nil) || !failed || attempts >= p.config.RetryTries ||
+			(permanent != nil && permanent(output)) {
+			return output, status, attempts, err
+		}
+
+		if err != nil {
+			ui.Error(err.Error())
+		}
+		ui.Say(fmt.Sprintf("%s failed, retrying in %s (attempt %d of %d)", name, p.config.RetryDelay, attempts+1, p.config.RetryTries))
+		select {
+		case <-ctx.Done():
+			return output, status, attempts, ctx.Err()
+		case <-time.After(p.config.RetryDelay):
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package apt
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var snapshotTimestampRe = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z$`)
+
+// snapshotArchives maps the archives of the Debian and Ubuntu mirrors to the
+// snapshot services that keep their past states.
+var snapshotArchives = map[string]string{
+	"debian":          "https://snapshot.debian.org/archive/debian/",
+	"debian-security": "https://snapshot.debian.org/archive/debian-security/",
+	"debian-ports":    "https://snapshot.debian.org/archive/debian-ports/",
+	"debian-debug":    "https://snapshot.debian.org/archive/debian-debug/",
+	"ubuntu":          "https://snapshot.ubuntu.com/ubuntu/",
+}
+
+// snapshotURI returns the URI of the snapshot of a Debian or Ubuntu mirror
+// at timestamp. The archive is named by the last element of the mirror path,
+// e.g. debian-security for http://security.debian.org/debian-security.
+func snapshotURI(uri, timestamp string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	host := strings.ToLower(u.Hostname())
+	archive := path.Base(strings.TrimSuffix(u.Path, "/"))
+	base, ok := snapshotArchives[archive]
+	isDebian := host == "debian.org" || strings.HasSuffix(host, ".debian.org")
+	isUbuntu := host == "ubuntu.com" || strings.HasSuffix(host, ".ubuntu.com")
+	if !ok || (isDebian && archive == "ubuntu") || (isUbuntu && archive != "ubuntu") || (!isDebian && !isUbuntu) {
+		return "", fmt.Errorf("no snapshot archive is known for %q", uri)
+	}
+	return base + timestamp + "/", nil
+}
+
+// isSnapshotURI reports whether uri already points at a snapshot archive.
+func isSnapshotURI(uri string) bool {
+	for _, base := range snapshotArchives {
+		if strings.HasPrefix(uri, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// pinSnapshot points the URIs of the source at their snapshot archive.
+func (s *Deb822Source) pinSnapshot() error {
+	if !snapshotTimestampRe.MatchString(s.SnapshotTimestamp) {
+		return fmt.Errorf("snapshot_timestamp must look like 20230601T000000Z: %q", s.SnapshotTimestamp)
+	}
+	for i, uri := range s.URIs {
+		if isSnapshotURI(uri) {
+			continue
+		}
+		snapshot, err := snapshotURI(uri, s.SnapshotTimestamp)
+		if err != nil {
+			return err
+		}
+		s.URIs[i] = snapshot
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// solverPackages maps the external solvers apt supports through EDSP to the
+// packages that provide them. The internal solver needs no package.
+var solverPackages = map[string][]string{
+	"internal": nil,
+	"apt":      {"apt-utils"},
+	"aspcud":   {"apt-cudf", "aspcud"},
+	"mccs":     {"apt-cudf", "mccs"},
+}
+
+func (p *Provisioner) solverOptions() string {
+	if p.config.Solver == "" {
+		return ""
+	}
+	return "-o APT::Solver=" + p.config.Solver + " "
+}
+
+// ensureRemoteSolver installs the solver packages unless the solver is
+// already present in apt's solvers directory.
+func (p *Provisioner) ensureRemoteSolver(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	packages := solverPackages[p.config.Solver]
+	if len(packages) == 0 {
+		return nil
+	}
+
+	cmd := &packer.RemoteCmd{
+		Command: fmt.Sprintf("test -x /usr/lib/apt/solvers/%s || %s",
+			p.config.Solver,
+			p.aptCommand(noninteractive, "/usr/bin/apt-get install -y --no-install-recommends "+strings.Join(packages, " ")),
+		),
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("failed to install the %s solver: exit status %d", p.config.Solver, cmd.ExitStatus())
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// sourceLine is a one-line style APT source as described in sources.list(5).
+type sourceLine struct {
+	Type       string
+	Options    []string
+	URI        string
+	Suite      string
+	Components []string
+}
+
+// parseSourceLine splits a one-line source into its fields, returning false
+// when the line doesn't have at least a type, a URI and a suite.
+func parseSourceLine(line string) (sourceLine, bool) {
+	var s sourceLine
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return s, false
+	}
+	s.Type, line = fields[0], strings.TrimSpace(line[len(fields[0]):])
+
+	if strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "]")
+		if end < 0 {
+			return s, false
+		}
+		s.Options = strings.Fields(line[1:end])
+		line = line[end+1:]
+	}
+
+	fields = strings.Fields(line)
+	if len(fields) == 0 {
+		return s, false
+	}
+	s.URI = fields[0]
+	if len(fields) < 2 {
+		return s, false
+	}
+	s.Suite, s.Components = fields[1], fields[2:]
+	return s, true
+}
+
+var (
+	// sourceOptionRe matches an option of the [options] block, which may add
+	// to or remove from its default with += and -=.
+	sourceOptionRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*[+-]?=[^=\s]+$`)
+	// sourceURIRe matches the scheme every source URI starts with.
+	sourceURIRe = regexp.MustCompile(`^[a-z][a-z0-9+.-]*:`)
+)
+
+// validateSourceLine checks a one-line source against sources.list(5),
+// describing the first field that is wrong.
+func validateSourceLine(line string) error {
+	if strings.Contains(line, "\n") {
+		return fmt.Errorf("a source must be a single line")
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || (fields[0] != "deb" && fields[0] != "deb-src") {
+		return fmt.Errorf("line must start with deb or deb-src")
+	}
+
+	rest := strings.TrimSpace(line[len(fields[0]):])
+	if strings.HasPrefix(rest, "[") && !strings.Contains(rest, "]") {
+		return fmt.Errorf("options block is missing its closing ]")
+	}
+	s, ok := parseSourceLine(line)
+	if strings.HasPrefix(rest, "[") && len(s.Options) == 0 {
+		return fmt.Errorf("options block is empty")
+	}
+	for _, option := range s.Options {
+		if !sourceOptionRe.MatchString(option) {
+			return fmt.Errorf("option %q must be name=value", option)
+		}
+	}
+	if s.URI == "" {
+		return fmt.Errorf("missing URI")
+	}
+	if !sourceURIRe.MatchString(s.URI) {
+		return fmt.Errorf("URI %q has no scheme", s.URI)
+	}
+	if !ok {
+		return fmt.Errorf("missing suite after URI %q", s.URI)
+	}
+	if strings.HasSuffix(s.Suite, "/") {
+		if len(s.Components) != 0 {
+			return fmt.Errorf("suite %q is an exact path and takes no components", s.Suite)
+		}
+	} else if len(s.Components) == 0 {
+		return fmt.Errorf("suite %q needs at least one component", s.Suite)
+	}
+	return nil
+}
+
+// sources expands the shorthand into one deb source per suite. Components
+// default to main.
+func (q QuickSource) sources() ([]string, error) {
+	if strings.TrimSpace(q.Mirror) == "" || strings.ContainsAny(q.Mirror, " \t") {
+		return nil, fmt.Errorf("mirror must be a single URI: %q", q.Mirror)
+	}
+	if len(q.Suites) == 0 {
+		return nil, fmt.Errorf("at least one suite is required")
+	}
+	components := q.Components
+	if len(components) == 0 {
+		components = []string{"main"}
+	}
+
+	var sources []string
+	for _, suite := range q.Suites {
+		if strings.TrimSpace(suite) == "" {
+			return nil, fmt.Errorf("suites must not be blank")
+		}
+		sources = append(sources, fmt.Sprintf("deb %s %s %s", q.Mirror, suite, strings.Join(components, " ")))
+	}
+	return sources, nil
+}
+
+// withSourceRepos follows each deb source with the matching deb-src source,
+// unless the sources already list it.
+func withSourceRepos(sources []string) []string {
+	listed := make(map[string]bool)
+	for _, source := range sources {
+		listed[strings.TrimSpace(source)] = true
+	}
+
+	var paired []string
+	for _, source := range sources {
+		paired = append(paired, source)
+		if s, ok := parseSourceLine(source); !ok || s.Type != "deb" {
+			continue
+		}
+		src := "deb-src" + strings.TrimPrefix(strings.TrimSpace(source), "deb")
+		if !listed[src] {
+			listed[src] = true
+			paired = append(paired, src)
+		}
+	}
+	return paired
+}
+
+// localSourcePaths returns the guest directories of file:// sources.
+func localSourcePaths(sources []string) []string {
+	var paths []string
+	for _, source := range sources {
+		if s, ok := parseSourceLine(source); ok && strings.HasPrefix(s.URI, "file:") {
+			if u, err := url.Parse(s.URI); err == nil && u.Path != "" {
+				paths = append(paths, u.Path)
+			}
+		}
+	}
+	return paths
+}
+
+// onlyLocalSources reports whether every configured source is a file://
+// repository, in which case no network access is needed to update.
+func onlyLocalSources(sources []string) bool {
+	return len(sources) != 0 && len(localSourcePaths(sources)) == len(sources)
+}
+
+func (p *Provisioner) checkRemoteLocalSources(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var missing []string
+	for _, dir := range localSourcePaths(p.config.sourceLines()) {
+		cmd := &packer.RemoteCmd{Command: fmt.Sprintf("/usr/bin/test -d '%s'", dir)}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return err
+		}
+		if cmd.ExitStatus() != 0 {
+			missing = append(missing, dir)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("file:// repositories are missing on the guest: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// signedByPaths returns the keyring paths referenced by signed-by options in
+// one-line sources or Signed-By fields in deb822 stanzas. Fingerprints, which
+// signed-by also accepts, are skipped.
+func signedByPaths(sources []string) []string {
+	var paths []string
+	seen := map[string]bool{}
+	add := func(values string) {
+		for _, value := range strings.Split(values, ",") {
+			value = strings.TrimSpace(value)
+			if path.IsAbs(value) && !seen[value] {
+				seen[value] = true
+				paths = append(paths, value)
+			}
+		}
+	}
+
+	for _, source := range sources {
+		for _, line := range strings.Split(source, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(strings.ToLower(line), "signed-by:") {
+				add(line[len("signed-by:"):])
+				continue
+			}
+			start := strings.Index(line, "[")
+			end := strings.Index(line, "]")
+			if start < 0 || end < start {
+				continue
+			}
+			for _, option := range strings.Fields(line[start+1 : end]) {
+				if strings.HasPrefix(option, "signed-by=") {
+					add(option[len("signed-by="):])
+				}
+			}
+		}
+	}
+	return paths
+}
+
+func (p *Provisioner) checkRemoteKeyrings(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var missing []string
+	for _, keyring := range signedByPaths(p.config.sourceLines()) {
+		cmd := &packer.RemoteCmd{Command: fmt.Sprintf("/usr/bin/test -e '%s'", keyring)}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return err
+		}
+		if cmd.ExitStatus() != 0 {
+			missing = append(missing, keyring)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("keyrings referenced by signed-by are missing on the guest: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
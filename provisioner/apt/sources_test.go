@@ -0,0 +1,191 @@
+package apt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestValidateSourceLine(t *testing.T) {
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{"deb http://deb.debian.org/debian bookworm main", ""},
+		{"deb-src http://deb.debian.org/debian bookworm main contrib non-free-firmware", ""},
+		{"deb [arch=amd64 signed-by=/usr/share/keyrings/docker.gpg] https://download.docker.com/linux/debian bookworm stable", ""},
+		{"deb [arch+=arm64 lang-=de] http://deb.debian.org/debian sid main", ""},
+		{"deb [trusted=yes] file:///media/cdrom ./", ""},
+		{"deb cdrom:[Debian GNU/Linux 12]/ bookworm main", ""},
+		{"deb http://deb.debian.org/debian bookworm main # comment", ""},
+		{"rpm http://deb.debian.org/debian bookworm main", "line must start with deb or deb-src"},
+		{"", "line must start with deb or deb-src"},
+		{"deb http://a bookworm main\ndeb http://b bookworm main", "a source must be a single line"},
+		{"deb", "missing URI"},
+		{"deb [arch=amd64]", "missing URI"},
+		{"deb [arch=amd64 http://deb.debian.org/debian bookworm main", "options block is missing its closing ]"},
+		{"deb [] http://deb.debian.org/debian bookworm main", "options block is empty"},
+		{"deb [arch] http://deb.debian.org/debian bookworm main", `option "arch" must be name=value`},
+		{"deb [arch=] http://deb.debian.org/debian bookworm main", `option "arch=" must be name=value`},
+		{"deb deb.debian.org/debian bookworm main", `URI "deb.debian.org/debian" has no scheme`},
+		{"deb http://deb.debian.org/debian", `missing suite after URI "http://deb.debian.org/debian"`},
+		{"deb http://deb.debian.org/debian bookworm", `suite "bookworm" needs at least one component`},
+		{"deb http://example.com/repo ./ main", `suite "./" is an exact path and takes no components`},
+	}
+	for _, tt := range tests {
+		err := validateSourceLine(tt.line)
+		if tt.err == "" && err != nil {
+			t.Errorf("validateSourceLine(%q): unexpected error: %v", tt.line, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("validateSourceLine(%q) = %v, want %q", tt.line, err, tt.err)
+		}
+	}
+}
+
+func TestPrepareSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		err     string
+	}{
+		{name: "valid", sources: []string{"deb http://deb.debian.org/debian bookworm main"}},
+		{
+			name:    "invalid line is named",
+			sources: []string{"deb http://deb.debian.org/debian bookworm main", "deb http://example.com/debian stable"},
+			err:     `sources: suite "stable" needs at least one component: "deb http://example.com/debian stable"`,
+		},
+		{
+			name:    "duplicate",
+			sources: []string{"deb http://deb.debian.org/debian bookworm main", "deb http://deb.debian.org/debian bookworm main"},
+			err:     "sources: duplicate line",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prepare(t, map[string]interface{}{"sources": tt.sources})
+			if tt.err == "" && err != "" {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !strings.Contains(err, tt.err) {
+				t.Fatalf("expected error containing %q, got %q", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestParseSourceLine(t *testing.T) {
+	s, ok := parseSourceLine("deb [arch=amd64 signed-by=/k.gpg] https://example.com/debian stable main contrib")
+	if !ok || s.Type != "deb" || s.URI != "https://example.com/debian" || s.Suite != "stable" ||
+		strings.Join(s.Options, " ") != "arch=amd64 signed-by=/k.gpg" || strings.Join(s.Components, " ") != "main contrib" {
+		t.Errorf("unexpected parse: %+v, %v", s, ok)
+	}
+	if s, ok := parseSourceLine("deb http://example.com/debian"); ok || s.URI != "http://example.com/debian" {
+		t.Errorf("expected the URI without a suite, got %+v, %v", s, ok)
+	}
+}
+
+func TestSignedByPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		want    []string
+	}{
+		{name: "no signed-by", sources: []string{"deb http://deb.debian.org/debian bookworm main"}},
+		{
+			name: "one-line options",
+			sources: []string{
+				"deb [arch=amd64 signed-by=/usr/share/keyrings/docker.gpg] https://download.docker.com/linux/debian bookworm stable",
+				"deb [signed-by=/etc/apt/keyrings/a.gpg,/etc/apt/keyrings/b.gpg] https://example.com/debian stable main",
+			},
+			want: []string{"/usr/share/keyrings/docker.gpg", "/etc/apt/keyrings/a.gpg", "/etc/apt/keyrings/b.gpg"},
+		},
+		{
+			name: "deb822 and duplicates",
+			sources: []string{
+				"Types: deb\nURIs: https://example.com/debian\nSuites: stable\nComponents: main\nSigned-By: /etc/apt/keyrings/example.gpg\n",
+				"deb [signed-by=/etc/apt/keyrings/example.gpg] https://example.com/debian testing main",
+			},
+			want: []string{"/etc/apt/keyrings/example.gpg"},
+		},
+		{
+			name: "fingerprints and inline keys are not paths",
+			sources: []string{
+				"deb [signed-by=0123456789ABCDEF0123456789ABCDEF01234567] https://example.com/debian stable main",
+				"Types: deb\nURIs: https://example.com/debian\nSuites: stable\nComponents: main\nSigned-By:\n -----BEGIN PGP PUBLIC KEY BLOCK-----\n .\n -----END PGP PUBLIC KEY BLOCK-----\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signedByPaths(tt.sources); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRemoteKeyrings(t *testing.T) {
+	sources := []string{
+		"deb [signed-by=/usr/share/keyrings/present.gpg] https://example.com/debian stable main",
+		"deb [signed-by=/usr/share/keyrings/missing.gpg] https://example.com/debian testing main",
+	}
+	tests := []struct {
+		name string
+		fail string
+		err  string
+	}{
+		{name: "all present"},
+		{
+			name: "missing keyring",
+			fail: "missing.gpg",
+			err:  "keyrings referenced by signed-by are missing on the guest: /usr/share/keyrings/missing.gpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm := &fakeComm{status: failing(tt.fail)}
+			p := &Provisioner{config: Config{Sources: sources}}
+
+			err := p.checkRemoteKeyrings(context.Background(), packer.TestUi(t), comm)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+			want := "/usr/bin/test -e '/usr/share/keyrings/present.gpg'\n/usr/bin/test -e '/usr/share/keyrings/missing.gpg'"
+			if got := strings.Join(comm.commands, "\n"); got != want {
+				t.Errorf("commands:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestUploadPackageList(t *testing.T) {
+	config := Config{
+		Sources:         []string{"deb http://deb.debian.org/debian bookworm main"},
+		SourcesListDir:  "/etc/apt/sources.list.d",
+		SourcesFilename: "packer.list",
+	}
+
+	comm := &fakeComm{}
+	p := &Provisioner{config: config}
+	if err := p.uploadPackageList(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := comm.uploads["/etc/apt/sources.list.d/packer.list"]; got != "deb http://deb.debian.org/debian bookworm main\n" {
+		t.Errorf("unexpected sources list %q", got)
+	}
+
+	comm = &fakeComm{status: failing("/bin/mkdir")}
+	err := p.uploadPackageList(context.Background(), packer.TestUi(t), comm)
+	if err == nil || !strings.Contains(err.Error(), "/bin/mkdir -p '/etc/apt/sources.list.d'") {
+		t.Fatalf("expected the failed mkdir, got %v", err)
+	}
+	if len(comm.uploads) != 0 {
+		t.Errorf("sources uploaded after a failed mkdir: %v", comm.uploads)
+	}
+}
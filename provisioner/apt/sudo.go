@@ -0,0 +1,83 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// sudoCommunicator runs every command through sudo and stages uploads in a
+// temporary location, so that a communicator connected as an unprivileged
+// user can write to the root-owned APT directories.
+type sudoCommunicator struct {
+	packer.Communicator
+	sudo    string
+	uploads int32
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func (c *sudoCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	cmd.Command = c.sudo + " /bin/sh -c " + shellQuote(cmd.Command)
+	return c.Communicator.Start(ctx, cmd)
+}
+
+// run runs command as root and fails unless it exits with status 0.
+func (c *sudoCommunicator) run(command string) error {
+	cmd := &packer.RemoteCmd{Command: command}
+	if err := c.Start(context.TODO(), cmd); err != nil {
+		return err
+	}
+	if status := cmd.Wait(); status != 0 {
+		return fmt.Errorf("%s: exit status %d", command, status)
+	}
+	return nil
+}
+
+func (c *sudoCommunicator) stagingPath() string {
+	return fmt.Sprintf("/tmp/packer-apt-upload-%d-%d", os.Getpid(), atomic.AddInt32(&c.uploads, 1))
+}
+
+func (c *sudoCommunicator) Upload(dst string, r io.Reader, fi *os.FileInfo) error {
+	tmp := c.stagingPath()
+	if err := c.Communicator.Upload(tmp, r, fi); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if fi != nil {
+		mode = (*fi).Mode().Perm()
+	}
+	return c.run(fmt.Sprintf("/usr/bin/install -o root -g root -m %04o %s %s; status=$?; rm -f %s; exit $status",
+		mode, shellQuote(tmp), shellQuote(dst), shellQuote(tmp)))
+}
+
+func (c *sudoCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	tmp := c.stagingPath()
+	if err := c.Communicator.UploadDir(tmp, src, exclude); err != nil {
+		return err
+	}
+	return c.run(fmt.Sprintf("/bin/mkdir -p %[2]s && /bin/cp -R %[1]s/. %[2]s; status=$?; rm -rf %[1]s; exit $status",
+		shellQuote(tmp), shellQuote(path.Clean(dst))))
+}
+
+// Download reads the file as root, as some files under /var are only
+// readable by root.
+func (c *sudoCommunicator) Download(src string, w io.Writer) error {
+	cmd := &packer.RemoteCmd{Command: "/bin/cat " + shellQuote(src), Stdout: w}
+	if err := c.Start(context.TODO(), cmd); err != nil {
+		return err
+	}
+	if status := cmd.Wait(); status != 0 {
+		return fmt.Errorf("failed to read %s: exit status %d", src, status)
+	}
+	return nil
+}
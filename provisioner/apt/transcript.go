@@ -0,0 +1,22 @@
+package apt
+
+import (
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// transcriptUi records the output lines of a command on their way to the
+// UI, so that they can be saved exactly as shown.
+type transcriptUi struct {
+	packer.Ui
+	transcript *syncBuffer
+}
+
+func (u *transcriptUi) Message(line string) {
+	u.transcript.Write([]byte(line + "\n"))
+	u.Ui.Message(line)
+}
+
+func (u *transcriptUi) Error(line string) {
+	u.transcript.Write([]byte(line + "\n"))
+	u.Ui.Error(line)
+}
@@ -0,0 +1,105 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// transportMethod is an APT download method that needs a package on the
+// guest and its own URI schemes.
+type transportMethod struct {
+	Package string
+	// Schemes maps the schemes of the source URIs to the schemes of the
+	// method. URIs with other schemes, such as file:, are kept.
+	Schemes map[string]string
+}
+
+var transportMethods = map[string]transportMethod{
+	"https": {
+		Package: "apt-transport-https",
+		Schemes: map[string]string{"http": "https"},
+	},
+	"tor": {
+		Package: "apt-transport-tor",
+		Schemes: map[string]string{"http": "tor+http", "https": "tor+https"},
+	},
+}
+
+// transportMethodNames returns the valid transport_method values.
+func transportMethodNames() []string {
+	var names []string
+	for name := range transportMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rewriteURI switches uri to the scheme of the method.
+func (m transportMethod) rewriteURI(uri string) string {
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return uri
+	}
+	if scheme, ok := m.Schemes[uri[:i]]; ok {
+		return scheme + uri[i:]
+	}
+	return uri
+}
+
+// rewriteSourceLine switches the URI of a one-line source to the scheme of
+// the method.
+func (m transportMethod) rewriteSourceLine(line string) string {
+	s, ok := parseSourceLine(line)
+	if !ok {
+		return line
+	}
+	return strings.Replace(line, s.URI, m.rewriteURI(s.URI), 1)
+}
+
+// applyTransportMethod rewrites the URIs of the sources and deb822 sources to
+// the scheme of the transport method.
+func (c *Config) applyTransportMethod() {
+	m := transportMethods[c.TransportMethod]
+	for i, source := range c.Sources {
+		c.Sources[i] = m.rewriteSourceLine(source)
+	}
+	for i := range c.Deb822Sources {
+		for j, uri := range c.Deb822Sources[i].URIs {
+			c.Deb822Sources[i].URIs[j] = m.rewriteURI(uri)
+		}
+	}
+}
+
+// installRemoteTransport installs the package of the transport method with
+// the sources already on the guest, so that the rewritten sources can be
+// fetched.
+func (p *Provisioner) installRemoteTransport(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	pkg := transportMethods[p.config.TransportMethod].Package
+	status, err := runRemoteOutput(ctx, comm, fmt.Sprintf("/usr/bin/dpkg-query -W -f '${db:Status-Abbrev}' %s 2>/dev/null || true", pkg))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(status, "ii") && !p.config.Explain {
+		ui.Say(fmt.Sprintf("%s is already installed", pkg))
+		return nil
+	}
+
+	ui.Say(fmt.Sprintf("Installing %s for the %s transport method", pkg, p.config.TransportMethod))
+	if err := p.updateRemotePackageIndex(ctx, ui, comm); err != nil {
+		return err
+	}
+	cmd := &packer.RemoteCmd{Command: p.aptCommand(noninteractive, fmt.Sprintf(
+		"%s -y --no-install-recommends %s", p.frontendCommand("install"), pkg))}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("installing %s exited with status %d", pkg, status)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package apt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestTransportRewriteSourceLine(t *testing.T) {
+	tests := []struct {
+		method string
+		line   string
+		want   string
+	}{
+		{"https", "deb http://deb.debian.org/debian bookworm main", "deb https://deb.debian.org/debian bookworm main"},
+		{"https", "deb https://deb.debian.org/debian bookworm main", "deb https://deb.debian.org/debian bookworm main"},
+		{"tor", "deb [arch=amd64] http://deb.debian.org/debian bookworm main", "deb [arch=amd64] tor+http://deb.debian.org/debian bookworm main"},
+		{"tor", "deb-src https://deb.debian.org/debian bookworm main", "deb-src tor+https://deb.debian.org/debian bookworm main"},
+		{"tor", "deb file:///srv/repo ./", "deb file:///srv/repo ./"},
+	}
+	for _, tt := range tests {
+		if got := transportMethods[tt.method].rewriteSourceLine(tt.line); got != tt.want {
+			t.Errorf("%s: rewriteSourceLine(%q) = %q, want %q", tt.method, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareTransportMethod(t *testing.T) {
+	source := "deb http://deb.debian.org/debian bookworm main"
+	tests := []struct {
+		name   string
+		raw    map[string]interface{}
+		source string
+		uri    string
+		err    string
+	}{
+		{
+			name: "tor with a probe on the configured URI",
+			raw: map[string]interface{}{
+				"transport_method": "tor",
+				"sources":          []string{source},
+				"deb822_sources":   []map[string]interface{}{{"uris": []string{"https://example.com/apt"}, "suites": []string{"stable"}, "components": []string{"main"}}},
+				"source_probes":    map[string]string{"http://deb.debian.org/debian": "hello"},
+			},
+			source: "deb tor+http://deb.debian.org/debian bookworm main",
+			uri:    "tor+https://example.com/apt",
+		},
+		{
+			name:   "https",
+			raw:    map[string]interface{}{"transport_method": "https", "sources": []string{source}},
+			source: "deb https://deb.debian.org/debian bookworm main",
+		},
+		{
+			name: "unknown method",
+			raw:  map[string]interface{}{"transport_method": "gopher", "sources": []string{source}},
+			err:  "transport_method must be one of https, tor",
+		},
+		{
+			name: "tor with require_network",
+			raw:  map[string]interface{}{"transport_method": "tor", "sources": []string{source}, "require_network": true},
+			err:  "require_network can't check sources fetched through tor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := prepare(t, tt.raw)
+			if tt.err != "" {
+				if !strings.Contains(err, tt.err) {
+					t.Fatalf("expected error containing %q, got %q", tt.err, err)
+				}
+				return
+			}
+			if err != "" {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := p.config.Sources[0]; got != tt.source {
+				t.Errorf("source %q, want %q", got, tt.source)
+			}
+			if tt.uri != "" && p.config.Deb822Sources[0].URIs[0] != tt.uri {
+				t.Errorf("deb822 URI %q, want %q", p.config.Deb822Sources[0].URIs[0], tt.uri)
+			}
+		})
+	}
+}
+
+func TestProbeRemoteSourcesWithTransportMethod(t *testing.T) {
+	policy := `hello:
+  Installed: (none)
+  Candidate: 2.10-3
+  Version table:
+     2.10-3 500
+        500 tor+http://deb.debian.org/debian bookworm/main amd64 Packages
+`
+	comm := &fakeComm{output: func(command string) string {
+		if strings.Contains(command, "apt-cache policy") {
+			return policy
+		}
+		return ""
+	}}
+	p := &Provisioner{config: Config{
+		TransportMethod: "tor",
+		SourceProbes:    map[string]string{"http://deb.debian.org/debian": "hello"},
+	}}
+	if err := p.probeRemoteSources(context.Background(), packer.TestUi(t), comm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p.config.TransportMethod = ""
+	if err := p.probeRemoteSources(context.Background(), packer.TestUi(t), comm); err == nil {
+		t.Fatal("expected the probe to fail against tor+http without transport_method")
+	}
+}
+
+func TestInstallRemoteTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    string
+		fail      string
+		installed bool
+		err       bool
+	}{
+		{name: "already installed", status: "ii "},
+		{name: "not installed", installed: true},
+		{name: "install fails", fail: "--no-install-recommends apt-transport-tor", installed: true, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm := &fakeComm{
+				status: failing(tt.fail),
+				output: func(command string) string {
+					if strings.Contains(command, "dpkg-query") {
+						return tt.status
+					}
+					return ""
+				},
+			}
+			p := &Provisioner{config: Config{TransportMethod: "tor"}}
+
+			err := p.installRemoteTransport(context.Background(), packer.TestUi(t), comm)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v", err)
+			}
+			installed := strings.Contains(strings.Join(comm.commands, "\n"), "install -y --no-install-recommends apt-transport-tor")
+			if installed != tt.installed {
+				t.Errorf("installed %v, want %v:\n%s", installed, tt.installed, strings.Join(comm.commands, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// trimRemoteFreeSpace discards the unused blocks of every mounted filesystem
+// that supports it, so that thin provisioned disks shrink to the data that
+// remains. Disks without discard support make fstrim fail, which only fails
+// the build in strict mode.
+func (p *Provisioner) trimRemoteFreeSpace(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say("Trimming free space on mounted filesystems")
+	cmd := &packer.RemoteCmd{Command: "/sbin/fstrim -av"}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return p.softFail(ui, fmt.Sprintf("fstrim exited with status %d", status))
+	}
+	return nil
+}
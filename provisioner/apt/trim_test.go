@@ -0,0 +1,60 @@
+package apt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestTrimFreeSpaceRunsLast(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		trim bool
+	}{
+		{
+			name: "after every other step",
+			raw: map[string]interface{}{
+				"packages":         []string{"curl"},
+				"autoremove":       true,
+				"slim_image":       true,
+				"verify_cleanup":   true,
+				"trim_free_space":  true,
+				"command_prefix":   "nice -n 19",
+				"umask":            "027",
+				"environment_vars": []string{"APT_LISTCHANGES_FRONTEND=none"},
+			},
+			trim: true,
+		},
+		{name: "disabled", raw: map[string]interface{}{"packages": []string{"curl"}}},
+		{name: "dry run", raw: map[string]interface{}{"packages": []string{"curl"}, "trim_free_space": true, "dry_run": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, errs := prepare(t, tt.raw)
+			if errs != "" {
+				t.Fatal(errs)
+			}
+			comm := &fakeComm{}
+			if err := p.Provision(context.Background(), packer.TestUi(t), comm, nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			all := strings.Join(comm.commands, "\n")
+			if !tt.trim {
+				if strings.Contains(all, "fstrim") {
+					t.Errorf("fstrim run:\n%s", all)
+				}
+				return
+			}
+			if last := comm.commands[len(comm.commands)-1]; last != "/sbin/fstrim -av" {
+				t.Errorf("last command %q, want /sbin/fstrim -av:\n%s", last, all)
+			}
+			if strings.Count(all, "fstrim") != 1 {
+				t.Errorf("fstrim run more than once:\n%s", all)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const unmetHeader = "The following packages have unmet dependencies:"
+
+func hasUnmetDependencies(output string) bool {
+	return strings.Contains(output, unmetHeader) || strings.Contains(output, "E: Unmet dependencies")
+}
+
+// unmetDetails returns the dependency lines apt prints after unmetHeader.
+func unmetDetails(output string) []string {
+	var details []string
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != unmetHeader {
+			continue
+		}
+		for _, detail := range lines[i+1:] {
+			detail = strings.TrimSpace(detail)
+			if detail == "" || strings.HasPrefix(detail, "E:") {
+				break
+			}
+			details = append(details, detail)
+		}
+		break
+	}
+	return details
+}
+
+// unpinPackages strips version and release pins from package specs.
+func unpinPackages(packages []string) []string {
+	unpinned := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		if i := strings.IndexAny(pkg, "=/"); i >= 0 {
+			pkg = pkg[:i]
+		}
+		unpinned = append(unpinned, pkg)
+	}
+	return unpinned
+}
+
+func (p *Provisioner) resolveUnmet(ctx context.Context, ui packer.Ui, comm packer.Communicator, output string, packages []string) error {
+	details := unmetDetails(output)
+	if !p.config.AutoResolveUnmet {
+		return fmt.Errorf("apt-get install failed on unmet dependencies, "+
+			"the requested packages or pinned versions conflict with each other or with installed packages: %s",
+			strings.Join(details, "; "))
+	}
+
+	options := ""
+	switch p.config.UnmetPolicy {
+	case "fix-broken":
+		ui.Say("Unmet dependencies, retrying apt-get install with --fix-broken")
+		options = "--fix-broken "
+	case "unpin":
+		packages = unpinPackages(packages)
+		ui.Say(fmt.Sprintf("Unmet dependencies, retrying apt-get install without version pins: %s", strings.Join(packages, " ")))
+	}
+
+	output, status, err := p.runInstall(ctx, ui, comm, options, packages)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("apt-get install failed after resolving unmet dependencies with policy %q: %s",
+			p.config.UnmetPolicy, strings.Join(unmetDetails(output), "; "))
+	}
+	ui.Say(fmt.Sprintf("Resolved unmet dependencies with policy %q", p.config.UnmetPolicy))
+	return nil
+}
@@ -0,0 +1,85 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var upgradeCommands = map[string]string{
+	"safe": "upgrade",
+	"full": "dist-upgrade",
+}
+
+// parseKeptBack returns the packages listed by apt-get upgrade under "The
+// following packages have been kept back:", e.g. because of phased updates.
+func parseKeptBack(output string) []string {
+	var kept []string
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "The following packages have been kept back") {
+			continue
+		}
+		for _, pkgs := range lines[i+1:] {
+			if !strings.HasPrefix(pkgs, " ") {
+				break
+			}
+			kept = append(kept, strings.Fields(pkgs)...)
+		}
+	}
+	return kept
+}
+
+// upgrade runs the upgrade step, refreshing the package index first when it
+// wasn't refreshed already.
+func (p *Provisioner) upgrade(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	if !p.config.refreshesIndex() {
+		if err := p.updateRemotePackageIndex(ctx, ui, comm); err != nil {
+			ui.Error("apt-get update failed")
+			return err
+		}
+	}
+	if err := p.upgradeRemotePackages(ctx, ui, comm); err != nil {
+		ui.Error("apt-get upgrade failed")
+		return err
+	}
+	return nil
+}
+
+// simulateOption returns the option that makes apt only simulate a dry run.
+func (p *Provisioner) simulateOption() string {
+	if p.config.DryRun {
+		return "-s "
+	}
+	return ""
+}
+
+func (p *Provisioner) upgradeRemotePackages(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var output syncBuffer
+	cmd := &packer.RemoteCmd{
+		Command: p.aptCommand(noninteractive, fmt.Sprintf("%s %s%s%s-y", p.upgradeCommand(), p.simulateOption(), p.solverOptions(), p.forceYesOptions())),
+		Stdout:  &output,
+		Stderr:  &output,
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("%s failed with exit status %d", p.upgradeCommand(), status)
+	}
+
+	kept := parseKeptBack(output.String())
+	if p.config.ReportKeptBack {
+		if len(kept) != 0 {
+			ui.Say(fmt.Sprintf("Packages kept back by %s: %s", p.upgradeCommand(), strings.Join(kept, " ")))
+		} else {
+			ui.Say("No packages were kept back")
+		}
+	}
+	if p.config.FailOnKeptBack && len(kept) != 0 {
+		return fmt.Errorf("%s kept back packages: %s", p.upgradeCommand(), strings.Join(kept, " "))
+	}
+	return nil
+}
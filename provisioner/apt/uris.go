@@ -0,0 +1,49 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// parsePrintURIs returns the URIs of apt-get --print-uris output, whose
+// lines hold a quoted URI followed by the file name, size and hash.
+func parsePrintURIs(output string) []string {
+	var uris []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "'") {
+			continue
+		}
+		if end := strings.Index(line[1:], "'"); end > 0 {
+			uris = append(uris, line[1:end+1])
+		}
+	}
+	return uris
+}
+
+// savePrintURIs writes the URIs apt would fetch to install the packages to
+// print_uris on the host, one per line.
+func (p *Provisioner) savePrintURIs(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say(fmt.Sprintf("Writing the URIs of the packages to install to %s", p.config.PrintURIs))
+	output, err := runRemoteOutput(ctx, comm, p.aptCommand(noninteractive, fmt.Sprintf(
+		"/usr/bin/apt-get install -qq -y --print-uris %s%s",
+		p.installOptions(""),
+		strings.Join(p.config.Packages, " "),
+	)))
+	if err != nil {
+		return err
+	}
+	if p.config.Explain {
+		return nil
+	}
+
+	var content string
+	for _, uri := range parsePrintURIs(output) {
+		content += uri + "\n"
+	}
+	return ioutil.WriteFile(p.config.PrintURIs, []byte(content), 0644)
+}
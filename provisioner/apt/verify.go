@@ -0,0 +1,54 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// simulatedChanges returns the packages that a simulated apt-get run would
+// install or remove, as reported by its Inst and Remv lines.
+func simulatedChanges(output string) []string {
+	var changes []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if fields[0] == "Inst" || fields[0] == "Remv" {
+			changes = append(changes, fields[0]+" "+fields[1])
+		}
+	}
+	return changes
+}
+
+func (p *Provisioner) assertRemoteConsistent(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	ui.Say("Verifying that all package dependencies are satisfied...")
+	output, err := runRemoteOutput(ctx, comm, p.aptCommand(nil, "/usr/bin/apt-get -s -f install"))
+	if err != nil {
+		return err
+	}
+	if changes := simulatedChanges(output); len(changes) != 0 {
+		return fmt.Errorf("package dependencies are not satisfied, apt-get proposes: %s", strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+func (p *Provisioner) verifyRemoteCleanup(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	var leftover []string
+	for _, file := range p.cleanupFiles() {
+		cmd := &packer.RemoteCmd{Command: fmt.Sprintf("/usr/bin/test -e '%s'", file)}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return err
+		}
+		if cmd.ExitStatus() == 0 {
+			leftover = append(leftover, file)
+		}
+	}
+	if len(leftover) != 0 {
+		return fmt.Errorf("files created by the provisioner remain after cleanup: %s", strings.Join(leftover, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// feature minimums enforced on top of Config.MinAptVersion.
+const signedByAptVersion = "1.1"
+
+// compareVersions compares two Debian package versions following the
+// algorithm of deb-version(7): epoch, then upstream version, then revision.
+func compareVersions(a, b string) int {
+	ae, au, ar := splitVersion(a)
+	be, bu, br := splitVersion(b)
+	if ae != be {
+		if ae < be {
+			return -1
+		}
+		return 1
+	}
+	if c := compareFragment(au, bu); c != 0 {
+		return c
+	}
+	return compareFragment(ar, br)
+}
+
+func splitVersion(v string) (epoch int, upstream string, revision string) {
+	if i := strings.Index(v, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(v[:i])
+		v = v[i+1:]
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+func versionOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case c >= '0' && c <= '9':
+		return 0
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// compareFragment alternately compares the non-digit and digit runs of two
+// upstream versions or revisions.
+func compareFragment(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			var ac, bc int
+			if a != "" {
+				ac = versionOrder(a[0])
+			}
+			if b != "" {
+				bc = versionOrder(b[0])
+			}
+			if ac != bc {
+				return ac - bc
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		for a != "" && a[0] == '0' {
+			a = a[1:]
+		}
+		for b != "" && b[0] == '0' {
+			b = b[1:]
+		}
+		c := 0
+		for a != "" && isDigit(a[0]) && b != "" && isDigit(b[0]) {
+			if c == 0 {
+				c = int(a[0]) - int(b[0])
+			}
+			a, b = a[1:], b[1:]
+		}
+		if a != "" && isDigit(a[0]) {
+			return 1
+		}
+		if b != "" && isDigit(b[0]) {
+			return -1
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// parseAptVersion extracts the version from the first line of
+// apt-get --version, e.g. "apt 2.6.1 (amd64)".
+func parseAptVersion(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != "apt" {
+		return "", fmt.Errorf("unexpected apt-get --version output: %q", strings.SplitN(output, "\n", 2)[0])
+	}
+	return fields[1], nil
+}
+
+// requiredAptVersion returns the highest apt version needed by the
+// configuration, or an empty string when any version will do.
+func (c *Config) requiredAptVersion() string {
+	required := c.MinAptVersion
+	raise := func(v string) {
+		if required == "" || compareVersions(v, required) > 0 {
+			required = v
+		}
+	}
+	if len(signedByPaths(c.sourceLines())) != 0 {
+		raise(signedByAptVersion)
+	}
+	return required
+}
+
+func (p *Provisioner) requireAptVersion(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	required := p.config.requiredAptVersion()
+	if required == "" {
+		return nil
+	}
+
+	output, err := runRemoteOutput(ctx, comm, "/usr/bin/apt-get --version")
+	if err != nil {
+		return err
+	}
+	if p.config.Explain {
+		ui.Say(fmt.Sprintf("Would require apt %s or newer", required))
+		return nil
+	}
+	installed, err := parseAptVersion(output)
+	if err != nil {
+		return err
+	}
+	if compareVersions(installed, required) < 0 {
+		return fmt.Errorf("apt %s is installed, but at least %s is required", installed, required)
+	}
+	ui.Say(fmt.Sprintf("Found apt %s (%s or newer required)", installed, required))
+	return nil
+}
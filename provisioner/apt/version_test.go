@@ -0,0 +1,88 @@
+package apt
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.6.1", "2.6.1", 0},
+		{"1.1", "1.1.0", -1},
+		{"2.6.1", "1.1", 1},
+		{"2.10", "2.9", 1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1.0", "1.0-1", -1},
+		{"1:1.0", "2.0", 1},
+		{"0:2.0", "2.0", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0+", -1},
+		{"1.07", "1.7", 0},
+		{"2:9.0.1378-2", "2:9.0.1378-1+deb12u1", 1},
+		{"7.88.1-10+deb12u5", "7.88.1-10+deb12u12", -1},
+		{"1.2.3-1ubuntu1", "1.2.3-1", 1},
+	}
+	for _, tt := range tests {
+		if got := sign(compareVersions(tt.a, tt.b)); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := sign(compareVersions(tt.b, tt.a)); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestParseAptVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+		err    bool
+	}{
+		{output: "apt 2.6.1 (amd64)\nSupported modules:\n", want: "2.6.1"},
+		{output: "apt 1.8.2.3 (arm64)", want: "1.8.2.3"},
+		{output: "sh: 1: apt-get: not found\n", err: true},
+		{output: "", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseAptVersion(tt.output)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseAptVersion(%q) = %q, %v", tt.output, got, err)
+		}
+	}
+}
+
+func TestRequiredAptVersion(t *testing.T) {
+	signed := []string{"deb [signed-by=/usr/share/keyrings/example.gpg] https://example.com/debian stable main"}
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{name: "no requirement"},
+		{name: "min_apt_version", config: Config{MinAptVersion: "2.0"}, want: "2.0"},
+		{name: "signed-by", config: Config{Sources: signed}, want: signedByAptVersion},
+		{name: "higher min_apt_version wins", config: Config{MinAptVersion: "2.2", Sources: signed}, want: "2.2"},
+		{name: "signed-by raises a lower minimum", config: Config{MinAptVersion: "1.0", Sources: signed}, want: signedByAptVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.requiredAptVersion(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}